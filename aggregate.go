@@ -0,0 +1,259 @@
+package jsnx
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// 聚合函数
+const (
+	AggCount = "count" //数值个数
+	AggSum   = "sum"
+	AggMin   = "min"
+	AggMax   = "max"
+	AggAvg   = "avg"
+)
+
+// 取数组元素内指定路径的数值(转换规则同GetFloat);
+// 默认跳过null 及非数字的值, strict=true 时返回错误
+func (holder *JsonHolder) numbers(path, subPath string, strict ...bool) ([]float64, error) {
+	_, items, err := holder.readArry(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return numberValues(items, path, subPath, len(strict) > 0 && strict[0])
+}
+
+func numberValues(items ArryNode, path, subPath string, strict bool) ([]float64, error) {
+	values := make([]float64, 0, len(items))
+	for i, item := range items {
+		node := elemValue(item, subPath)
+		if node == nil {
+			if strict {
+				return nil, fmt.Errorf("Path(%v) is null", elemPath(path, i, subPath))
+			}
+			continue
+		}
+
+		f, err := toFloat(node)
+		if err != nil {
+			if strict {
+				return nil, fmt.Errorf("Path(%v) not number: %v", elemPath(path, i, subPath), err)
+			}
+			continue
+		}
+
+		values = append(values, f)
+	}
+
+	return values, nil
+}
+
+// 数组元素内的路径, subPath 为空时为元素本身
+func elemPath(path string, i int, subPath string) string {
+	elem := joinIndex(cleanPath(path), i)
+	if subPath = cleanPath(subPath); subPath != "/" {
+		elem += subPath
+	}
+
+	return elem
+}
+
+// 数值个数
+func (holder *JsonHolder) Count(path, subPath string, strict ...bool) (int, error) {
+	values, err := holder.numbers(path, subPath, strict...)
+	return len(values), err
+}
+
+// 求和
+func (holder *JsonHolder) Sum(path, subPath string, strict ...bool) (float64, error) {
+	values, err := holder.numbers(path, subPath, strict...)
+	if err != nil {
+		return 0, err
+	}
+
+	return aggregate(AggSum, values)
+}
+
+// 最小值, 没有数值时返回错误
+func (holder *JsonHolder) Min(path, subPath string, strict ...bool) (float64, error) {
+	values, err := holder.numbers(path, subPath, strict...)
+	if err != nil {
+		return 0, err
+	}
+
+	return aggregate(AggMin, values)
+}
+
+// 最大值, 没有数值时返回错误
+func (holder *JsonHolder) Max(path, subPath string, strict ...bool) (float64, error) {
+	values, err := holder.numbers(path, subPath, strict...)
+	if err != nil {
+		return 0, err
+	}
+
+	return aggregate(AggMax, values)
+}
+
+// 平均值, 没有数值时返回错误
+func (holder *JsonHolder) Avg(path, subPath string, strict ...bool) (float64, error) {
+	values, err := holder.numbers(path, subPath, strict...)
+	if err != nil {
+		return 0, err
+	}
+
+	return aggregate(AggAvg, values)
+}
+
+// 百分位数(p 取值 0~100, 线性插值), 没有数值时返回错误
+func (holder *JsonHolder) Percentile(path, subPath string, p float64, strict ...bool) (float64, error) {
+	values, err := holder.numbers(path, subPath, strict...)
+	if err != nil {
+		return 0, err
+	}
+
+	return percentile(values, p)
+}
+
+// 按元素内的键值分组聚合, 返回 {分组键值: 聚合结果}; agg 为 AggCount/AggSum/AggMin/AggMax/AggAvg,
+// 百分位数用GroupPercentile
+func (holder *JsonHolder) GroupAggregate(path, groupPath, subPath, agg string, strict ...bool) (map[string]float64, error) {
+	switch agg {
+	case AggCount, AggSum, AggMin, AggMax, AggAvg:
+	default:
+		return nil, fmt.Errorf("invalid aggregate(%v)", agg)
+	}
+
+	keys, groups, err := holder.groupNumbers(path, groupPath, subPath, strict...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]float64, len(groups))
+	for _, key := range keys {
+		values := groups[key]
+		if len(values) == 0 && agg != AggCount && agg != AggSum {
+			continue //分组内没有数值
+		}
+
+		result[key], err = aggregate(agg, values)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// 按元素内的键值分组求百分位数(p 取值 0~100), 返回 {分组键值: 百分位数}; 没有数值的分组不返回
+func (holder *JsonHolder) GroupPercentile(path, groupPath, subPath string, p float64, strict ...bool) (map[string]float64, error) {
+	if p < 0 || p > 100 {
+		return nil, fmt.Errorf("invalid percentile(%v)", p)
+	}
+
+	keys, groups, err := holder.groupNumbers(path, groupPath, subPath, strict...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]float64, len(groups))
+	for _, key := range keys {
+		if len(groups[key]) == 0 {
+			continue
+		}
+
+		result[key], err = percentile(groups[key], p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// 按元素内的键值分组取数值, 返回分组键值(按出现顺序)及各分组的数值
+func (holder *JsonHolder) groupNumbers(path, groupPath, subPath string, strict ...bool) ([]string, map[string][]float64, error) {
+	_, items, err := holder.readArry(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(strict) > 0 && strict[0] {
+		//先检查全部元素, 错误信息中为原数组的索引
+		if _, err = numberValues(items, path, subPath, true); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	keys := make([]string, 0)
+	groups := make(map[string]ArryNode)
+	for _, item := range items {
+		key := groupKey(elemValue(item, groupPath))
+		if _, exist := groups[key]; !exist {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], item)
+	}
+
+	values := make(map[string][]float64, len(groups))
+	for _, key := range keys {
+		values[key], _ = numberValues(groups[key], path, subPath, false)
+	}
+
+	return keys, values, nil
+}
+
+func aggregate(agg string, values []float64) (float64, error) {
+	if len(values) == 0 && agg != AggCount && agg != AggSum {
+		return 0, fmt.Errorf("no numeric values")
+	}
+
+	switch agg {
+	case AggCount:
+		return float64(len(values)), nil
+	case AggSum:
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		return sum, nil
+	case AggMin:
+		min := math.Inf(1)
+		for _, v := range values {
+			min = math.Min(min, v)
+		}
+		return min, nil
+	case AggMax:
+		max := math.Inf(-1)
+		for _, v := range values {
+			max = math.Max(max, v)
+		}
+		return max, nil
+	case AggAvg:
+		sum, _ := aggregate(AggSum, values)
+		return sum / float64(len(values)), nil
+	}
+
+	return 0, fmt.Errorf("invalid aggregate(%v)", agg)
+}
+
+func percentile(values []float64, p float64) (float64, error) {
+	if len(values) == 0 {
+		return 0, fmt.Errorf("no numeric values")
+	}
+
+	if p < 0 || p > 100 {
+		return 0, fmt.Errorf("invalid percentile(%v)", p)
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo)), nil
+}
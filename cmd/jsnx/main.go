@@ -0,0 +1,460 @@
+// jsnx 命令行工具, 路径规则与JsonHolder 相同
+//
+//	jsnx get   [-raw] [-indent] file path
+//	jsnx set   [-string] [-indent] [-stdout] file path value
+//	jsnx del   [-indent] [-stdout] file path
+//	jsnx fmt   [-indent] [-spaces n] file
+//	jsnx keys  [-raw] file [path]
+//	jsnx len   file [path]
+//	jsnx query [-raw] [-indent] file pattern
+//	jsnx repl  file                            交互模式
+//
+// file 为 - 时读取标准输入, 修改结果输出到标准输出
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lvxms/jsnx"
+)
+
+// 退出码
+const (
+	exitOK       = 0
+	exitNotFound = 1 //路径不存在或类型不符
+	exitUsage    = 2 //参数错误
+	exitInput    = 3 //读写文件或JSON 解析失败
+)
+
+// 带退出码的错误
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func fail(code int, format string, args ...interface{}) error {
+	return &exitError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+type command struct {
+	usage string
+	run   func(fs *flag.FlagSet, args []string) error
+}
+
+var commands = map[string]*command{
+	"get":   {"get [-raw] [-indent] file path", cmdGet},
+	"set":   {"set [-string] [-indent] [-stdout] file path value", cmdSet},
+	"del":   {"del [-indent] [-stdout] file path", cmdDel},
+	"fmt":   {"fmt [-indent] [-spaces n] file", cmdFmt},
+	"keys":  {"keys [-raw] file [path]", cmdKeys},
+	"len":   {"len file [path]", cmdLen},
+	"query": {"query [-raw] [-indent] file pattern", cmdQuery},
+	"repl":  {"repl file", cmdRepl},
+}
+
+var stdout io.Writer = os.Stdout
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "usage: jsnx <command> [flags] file [args]\n\ncommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  jsnx %s\n", commands[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nfile \"-\" reads stdin; exit codes: 1 path not found, 2 usage, 3 input error\n")
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		usage()
+		return exitUsage
+	}
+
+	cmd, exist := commands[args[0]]
+	if !exist {
+		fmt.Fprintf(os.Stderr, "jsnx: unknown command %q\n", args[0])
+		usage()
+		return exitUsage
+	}
+
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: jsnx %s\n", cmd.usage)
+		fs.PrintDefaults()
+	}
+
+	err := cmd.run(fs, args[1:])
+	if err == nil {
+		return exitOK
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return exitUsage
+	}
+
+	fmt.Fprintf(os.Stderr, "jsnx %s: %v\n", args[0], err)
+
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		if exitErr.code == exitUsage {
+			fs.Usage()
+		}
+		return exitErr.code
+	}
+
+	return exitInput
+}
+
+// 解析参数, 检查位置参数个数
+func parseArgs(fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, &exitError{code: exitUsage, err: err}
+	}
+
+	if fs.NArg() < min || fs.NArg() > max {
+		return nil, fail(exitUsage, "wrong number of arguments")
+	}
+
+	return fs.Args(), nil
+}
+
+// 读取文件, 同时返回原文是否为多行(用于写回时保持格式)
+func load(file string) (*jsnx.JsonHolder, bool, error) {
+	var (
+		data []byte
+		err  error
+	)
+
+	if file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return nil, false, fail(exitInput, "%v", err)
+	}
+
+	holder := jsnx.NewEmptyHolder()
+	holder.KeepKeyOrder()
+	if err = holder.Parse(data); err != nil {
+		return nil, false, fail(exitInput, "%s: %v", file, err)
+	}
+
+	return holder, bytes.Contains(bytes.TrimSpace(data), []byte("\n")), nil
+}
+
+// 写回文件(先写临时文件再改名), file 为 - 或toStdout 时输出到标准输出
+func save(holder *jsnx.JsonHolder, file, indent string, toStdout bool) error {
+	str, err := holder.String("/", indent)
+	if err != nil {
+		return fail(exitInput, "%v", err)
+	}
+
+	if file == "-" || toStdout {
+		fmt.Fprintln(stdout, str)
+		return nil
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(file); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return fail(exitInput, "%v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(str + "\n")
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		return fail(exitInput, "%v", err)
+	}
+
+	return nil
+}
+
+// 输出结点: raw 模式下字符串不加引号
+func output(node interface{}, raw bool, indent string) error {
+	if s, ok := node.(string); ok && raw {
+		fmt.Fprintln(stdout, s)
+		return nil
+	}
+
+	str, err := jsnx.FormatJson(node, indent)
+	if err != nil {
+		return fail(exitInput, "%v", err)
+	}
+
+	fmt.Fprintln(stdout, str)
+	return nil
+}
+
+// 写回时的缩进: -indent 或原文为多行时缩进两个空格
+func writeIndent(indent, multiLine bool) string {
+	if indent || multiLine {
+		return "  "
+	}
+
+	return ""
+}
+
+// 取结点, 区分值为null 与路径不存在(Get 对不存在的键值也返回nil)
+func get(holder *jsnx.JsonHolder, path string) (interface{}, error) {
+	if _, err := holder.Get(path); err != nil {
+		return nil, fail(exitNotFound, "%v", err)
+	}
+
+	node, exist := holder.Lookup(path)
+	if !exist {
+		return nil, fail(exitNotFound, "path %s not found", path)
+	}
+
+	return node, nil
+}
+
+func cmdGet(fs *flag.FlagSet, args []string) error {
+	raw := fs.Bool("raw", false, "print strings without quotes")
+	indent := fs.Bool("indent", false, "indent JSON output")
+	args, err := parseArgs(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	holder, _, err := load(args[0])
+	if err != nil {
+		return err
+	}
+
+	node, err := get(holder, args[1])
+	if err != nil {
+		return err
+	}
+
+	return output(node, *raw, writeIndent(*indent, false))
+}
+
+func cmdSet(fs *flag.FlagSet, args []string) error {
+	asString := fs.Bool("string", false, "treat value as a plain string instead of JSON")
+	indent := fs.Bool("indent", false, "indent JSON output")
+	toStdout := fs.Bool("stdout", false, "print result instead of writing the file")
+	args, err := parseArgs(fs, args, 3, 3)
+	if err != nil {
+		return err
+	}
+
+	var value interface{} = args[2]
+	if !*asString {
+		v, err := jsnx.Parse(args[2])
+		if err != nil {
+			return fail(exitUsage, "value is not valid JSON (use -string for plain strings): %v", err)
+		}
+		value = v.Data
+	}
+
+	holder, multiLine, err := load(args[0])
+	if err != nil {
+		return err
+	}
+
+	if err = holder.SetJson(args[1], value); err != nil {
+		return fail(exitNotFound, "%v", err)
+	}
+
+	return save(holder, args[0], writeIndent(*indent, multiLine), *toStdout)
+}
+
+func cmdDel(fs *flag.FlagSet, args []string) error {
+	indent := fs.Bool("indent", false, "indent JSON output")
+	toStdout := fs.Bool("stdout", false, "print result instead of writing the file")
+	args, err := parseArgs(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	holder, multiLine, err := load(args[0])
+	if err != nil {
+		return err
+	}
+
+	if _, err = get(holder, args[1]); err != nil {
+		return err
+	}
+	if err = holder.Del(args[1]); err != nil {
+		return fail(exitNotFound, "%v", err)
+	}
+
+	return save(holder, args[0], writeIndent(*indent, multiLine), *toStdout)
+}
+
+func cmdFmt(fs *flag.FlagSet, args []string) error {
+	indent := fs.Bool("indent", false, "indent output (default compact)")
+	spaces := fs.Int("spaces", 2, "spaces per indent level, 0 for tabs")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	holder, _, err := load(args[0])
+	if err != nil {
+		return err
+	}
+
+	formatter := ""
+	if *indent {
+		formatter = "\t"
+		if *spaces > 0 {
+			formatter = strings.Repeat(" ", *spaces)
+		}
+	}
+
+	return output(holder.Data, false, formatter)
+}
+
+func cmdKeys(fs *flag.FlagSet, args []string) error {
+	raw := fs.Bool("raw", false, "print one key per line")
+	args, err := parseArgs(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+
+	holder, _, err := load(args[0])
+	if err != nil {
+		return err
+	}
+
+	path := "/"
+	if len(args) > 1 {
+		path = args[1]
+	}
+	if _, err = get(holder, path); err != nil {
+		return err
+	}
+
+	//按原文中的顺序输出
+	keys := make([]interface{}, 0)
+	err = holder.IterMap(path, jsnx.OrderInsertion, func(key string, node interface{}) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return fail(exitNotFound, "%v", err)
+	}
+
+	if *raw {
+		for _, key := range keys {
+			fmt.Fprintln(stdout, key)
+		}
+		return nil
+	}
+
+	return output(keys, false, "")
+}
+
+func cmdLen(fs *flag.FlagSet, args []string) error {
+	args, err := parseArgs(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+
+	holder, _, err := load(args[0])
+	if err != nil {
+		return err
+	}
+
+	path := "/"
+	if len(args) > 1 {
+		path = args[1]
+	}
+	node, err := get(holder, path)
+	if err != nil {
+		return err
+	}
+
+	switch n := node.(type) {
+	case jsnx.MapNode:
+		fmt.Fprintln(stdout, len(n))
+	case string:
+		fmt.Fprintln(stdout, utf8.RuneCountInString(n))
+	default:
+		length, err := holder.ArryLen(path)
+		if err != nil {
+			return fail(exitNotFound, "path %s is not an array, object or string", path)
+		}
+		fmt.Fprintln(stdout, length)
+	}
+
+	return nil
+}
+
+func cmdQuery(fs *flag.FlagSet, args []string) error {
+	raw := fs.Bool("raw", false, "print \"path<TAB>value\" lines")
+	indent := fs.Bool("indent", false, "indent JSON output")
+	args, err := parseArgs(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	holder, _, err := load(args[0])
+	if err != nil {
+		return err
+	}
+
+	matches := holder.Query(args[1])
+	if len(matches) == 0 {
+		return fail(exitNotFound, "no match for %s", args[1])
+	}
+
+	if *raw {
+		for _, m := range matches {
+			value := ""
+			if s, ok := m.Value.(string); ok {
+				value = s
+			} else if value, err = jsnx.FormatJson(m.Value, ""); err != nil {
+				return fail(exitInput, "%v", err)
+			}
+			fmt.Fprintf(stdout, "%s\t%s\n", m.Path, value)
+		}
+		return nil
+	}
+
+	result := make([]interface{}, len(matches))
+	for i, m := range matches {
+		result[i] = jsnx.MapNode{"path": m.Path, "value": m.Value}
+	}
+
+	return output(result, false, writeIndent(*indent, false))
+}
@@ -0,0 +1,622 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lvxms/jsnx"
+)
+
+// 交互模式的命令
+var replCommands = map[string]struct {
+	usage string
+	run   func(r *repl, args string) error
+}{
+	"cd":    {"cd [path]            change current node (.. for parent, / for root)", (*repl).cd},
+	"ls":    {"ls [path]            list keys or indexes with a value summary", (*repl).ls},
+	"cat":   {"cat [path]           print subtree as indented JSON", (*repl).cat},
+	"set":   {"set path json        set node to a JSON value", (*repl).set},
+	"rm":    {"rm path              delete node", (*repl).rm},
+	"query": {"query pattern        find nodes (* one level, ** any levels)", (*repl).query},
+	"save":  {"save [file]          write document (default: the loaded file)", (*repl).save},
+	"pwd":   {"pwd                  print current path", (*repl).pwd},
+	"help":  {"help                 show this help", nil},
+	"exit":  {"exit                 quit (exit! discards unsaved changes)", nil},
+}
+
+type repl struct {
+	holder *jsnx.JsonHolder
+	file   string
+	cwd    []string //当前路径各级
+	dirty  bool     //有未保存的修改
+	out    io.Writer
+}
+
+// 行输入: 终端中支持编辑/历史/补全, 否则逐行读取
+type lineReader interface {
+	readLine(prompt string) (string, error)
+	close()
+}
+
+func cmdRepl(fs *flag.FlagSet, args []string) error {
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if args[0] == "-" {
+		return fail(exitUsage, "repl needs a file, stdin is used for input")
+	}
+
+	holder, _, err := load(args[0])
+	if err != nil {
+		return err
+	}
+
+	r := &repl{holder: holder, file: args[0], out: stdout}
+
+	var reader lineReader
+	if term, err := newTerminal(os.Stdin, stdout, r.complete); err == nil {
+		reader = term
+	} else {
+		reader = &plainReader{in: bufio.NewReader(os.Stdin), out: stdout}
+	}
+	defer reader.close()
+
+	fmt.Fprintf(r.out, "loaded %s, type help for commands\n", args[0])
+	for {
+		line, err := reader.readLine("jsnx:" + r.path() + "> ")
+		if err == io.EOF {
+			if r.dirty {
+				fmt.Fprintln(r.out, "unsaved changes discarded")
+			}
+			return nil
+		}
+		if err != nil {
+			return fail(exitInput, "%v", err)
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		name, rest := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			name, rest = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		switch name {
+		case "exit", "quit":
+			if r.dirty {
+				fmt.Fprintln(r.out, "unsaved changes, use save or exit!")
+				continue
+			}
+			return nil
+		case "exit!", "quit!":
+			return nil
+		case "help":
+			r.help()
+			continue
+		}
+
+		cmd, exist := replCommands[name]
+		if !exist {
+			fmt.Fprintf(r.out, "unknown command %q, type help for commands\n", name)
+			continue
+		}
+
+		if err := cmd.run(r, rest); err != nil {
+			fmt.Fprintf(r.out, "error: %v\n", err)
+		}
+	}
+}
+
+// 当前路径
+func (r *repl) path() string {
+	return "/" + strings.Join(r.cwd, "/")
+}
+
+// 相对当前路径解析为完整路径
+func (r *repl) resolve(arg string) string {
+	segs := make([]string, 0)
+	if !strings.HasPrefix(arg, "/") {
+		segs = append(segs, r.cwd...)
+	}
+
+	for _, seg := range strings.Split(arg, "/") {
+		switch seg {
+		case "", ".":
+		case "..":
+			if len(segs) > 0 {
+				segs = segs[:len(segs)-1]
+			}
+		default:
+			segs = append(segs, seg)
+		}
+	}
+
+	return "/" + strings.Join(segs, "/")
+}
+
+func (r *repl) cd(args string) error {
+	path := r.resolve(args)
+	if args == "" {
+		path = "/"
+	}
+
+	node, err := get(r.holder, path)
+	if err != nil {
+		return err
+	}
+
+	switch node.(type) {
+	case jsnx.MapNode, jsnx.ArryNode, jsnx.ArryMapNode:
+	default:
+		return fmt.Errorf("%s is not an object or array", path)
+	}
+
+	r.cwd = strings.Split(strings.Trim(path, "/"), "/")
+	if path == "/" {
+		r.cwd = nil
+	}
+	return nil
+}
+
+func (r *repl) ls(args string) error {
+	path := r.resolve(args)
+	node, err := get(r.holder, path)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := node.(jsnx.MapNode); ok {
+		keys, err := r.holder.Keys(path, false)
+		if err != nil {
+			return err
+		}
+
+		//按原文中的顺序输出
+		order := make(map[string]int, len(keys))
+		r.holder.IterMap(path, jsnx.OrderInsertion, func(key string, node interface{}) error {
+			order[key] = len(order)
+			return nil
+		})
+		sort.Slice(keys, func(i, j int) bool {
+			return order[keys[i]] < order[keys[j]]
+		})
+
+		width := 0
+		for _, key := range keys {
+			if n := utf8.RuneCountInString(key); n > width {
+				width = n
+			}
+		}
+		for _, key := range keys {
+			child, _ := r.holder.Get(joinPath(path, quoteKey(key)))
+			fmt.Fprintf(r.out, "%-*s  %s\n", width, key, summary(child))
+		}
+		return nil
+	}
+
+	length, err := r.holder.ArryLen(path)
+	if err != nil {
+		return fmt.Errorf("%s is not an object or array", path)
+	}
+	width := len(strconv.Itoa(length))
+	for i := 0; i < length; i++ {
+		child, _ := r.holder.Get(joinPath(path, strconv.Itoa(i)))
+		fmt.Fprintf(r.out, "%*d  %s\n", width, i, summary(child))
+	}
+
+	return nil
+}
+
+func (r *repl) cat(args string) error {
+	node, err := get(r.holder, r.resolve(args))
+	if err != nil {
+		return err
+	}
+
+	str, err := jsnx.FormatJson(node, "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(r.out, str)
+	return nil
+}
+
+func (r *repl) set(args string) error {
+	fields := strings.SplitN(args, " ", 2)
+	if len(fields) < 2 || strings.TrimSpace(fields[1]) == "" {
+		return fmt.Errorf("usage: set path json")
+	}
+
+	value, err := jsnx.Parse(strings.TrimSpace(fields[1]))
+	if err != nil {
+		return fmt.Errorf("value is not valid JSON (quote strings): %v", err)
+	}
+
+	if err = r.holder.SetJson(r.resolve(fields[0]), value.Data); err != nil {
+		return err
+	}
+
+	r.dirty = true
+	return nil
+}
+
+func (r *repl) rm(args string) error {
+	if args == "" {
+		return fmt.Errorf("usage: rm path")
+	}
+
+	path := r.resolve(args)
+	if path == "/" {
+		return fmt.Errorf("cannot remove root")
+	}
+	if _, err := get(r.holder, path); err != nil {
+		return err
+	}
+	if err := r.holder.Del(path); err != nil {
+		return err
+	}
+
+	//当前路径被删除时回到上级
+	for len(r.cwd) > 0 && !r.exist(r.path()) {
+		r.cwd = r.cwd[:len(r.cwd)-1]
+	}
+
+	r.dirty = true
+	return nil
+}
+
+func (r *repl) query(args string) error {
+	if args == "" {
+		return fmt.Errorf("usage: query pattern")
+	}
+
+	matches := r.holder.Query(r.resolve(args))
+	for _, m := range matches {
+		fmt.Fprintf(r.out, "%s  %s\n", m.Path, summary(m.Value))
+	}
+	fmt.Fprintf(r.out, "%d match(es)\n", len(matches))
+
+	return nil
+}
+
+func (r *repl) save(args string) error {
+	file := r.file
+	if args != "" {
+		file = args
+	}
+
+	if err := save(r.holder, file, "  ", false); err != nil {
+		return err
+	}
+
+	if file == r.file {
+		r.dirty = false
+	}
+	fmt.Fprintf(r.out, "saved %s\n", file)
+	return nil
+}
+
+func (r *repl) pwd(args string) error {
+	fmt.Fprintln(r.out, r.path())
+	return nil
+}
+
+func (r *repl) help() {
+	names := make([]string, 0, len(replCommands))
+	for name := range replCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(r.out, "  %s\n", replCommands[name].usage)
+	}
+	fmt.Fprintln(r.out, "paths are relative to the current node unless they start with /; tab completes keys")
+}
+
+func (r *repl) exist(path string) bool {
+	_, err := get(r.holder, path)
+	return err == nil
+}
+
+// 补全光标前的最后一个词, 返回词的起始位置及候选
+func (r *repl) complete(line string) (int, []string) {
+	start := strings.LastIndexAny(line, " \t") + 1
+	word := line[start:]
+
+	candidates := make([]string, 0)
+	if start == 0 {
+		for name := range replCommands {
+			if strings.HasPrefix(name, word) {
+				candidates = append(candidates, name+" ")
+			}
+		}
+		sort.Strings(candidates)
+		return start, candidates
+	}
+
+	dir, partial := "", word
+	if i := strings.LastIndex(word, "/"); i >= 0 {
+		dir, partial = word[:i+1], word[i+1:]
+	}
+
+	node, err := get(r.holder, r.resolve(dir))
+	if err != nil {
+		return start, candidates
+	}
+
+	names := make([]string, 0)
+	children := make(map[string]interface{})
+	switch n := node.(type) {
+	case jsnx.MapNode:
+		for key, child := range n {
+			names = append(names, quoteKey(key))
+			children[quoteKey(key)] = child
+		}
+		sort.Strings(names)
+	default:
+		length, _ := r.holder.ArryLen(r.resolve(dir))
+		for i := 0; i < length; i++ {
+			child, _ := r.holder.Get(joinPath(r.resolve(dir), strconv.Itoa(i)))
+			names = append(names, strconv.Itoa(i))
+			children[strconv.Itoa(i)] = child
+		}
+	}
+
+	for _, name := range names {
+		if !strings.HasPrefix(name, partial) {
+			continue
+		}
+
+		switch children[name].(type) {
+		case jsnx.MapNode, jsnx.ArryNode, jsnx.ArryMapNode:
+			candidates = append(candidates, dir+name+"/")
+		default:
+			candidates = append(candidates, dir+name+" ")
+		}
+	}
+
+	return start, candidates
+}
+
+// 数字键值加双引号, 与Get 的规则一致
+func quoteKey(key string) string {
+	if _, err := strconv.Atoi(key); err == nil {
+		return "\"" + key + "\""
+	}
+
+	return key
+}
+
+func joinPath(path, key string) string {
+	return strings.TrimSuffix(path, "/") + "/" + key
+}
+
+// 值的简要显示
+func summary(node interface{}) string {
+	switch n := node.(type) {
+	case jsnx.MapNode:
+		return fmt.Sprintf("{%d}", len(n))
+	case jsnx.ArryNode:
+		return fmt.Sprintf("[%d]", len(n))
+	case jsnx.ArryMapNode:
+		return fmt.Sprintf("[%d]", len(n))
+	}
+
+	str, err := jsnx.FormatJson(node, "")
+	if err != nil {
+		return fmt.Sprint(node)
+	}
+	if utf8.RuneCountInString(str) > 60 {
+		str = string([]rune(str)[:57]) + "..."
+	}
+
+	return str
+}
+
+// 非终端时逐行读取
+type plainReader struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (p *plainReader) readLine(prompt string) (string, error) {
+	fmt.Fprint(p.out, prompt)
+
+	line, err := p.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		return line, nil
+	}
+
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func (p *plainReader) close() {
+}
+
+// 终端行编辑: 左右移动, Home/End, 历史, Tab 补全, Ctrl-C 取消当前行, Ctrl-D 结束
+type terminal struct {
+	in       *bufio.Reader
+	out      io.Writer
+	restore  func()
+	history  []string
+	complete func(line string) (int, []string)
+}
+
+func newTerminal(in *os.File, out io.Writer, complete func(line string) (int, []string)) (*terminal, error) {
+	restore, err := makeRaw(int(in.Fd()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &terminal{in: bufio.NewReader(in), out: out, restore: restore, complete: complete}, nil
+}
+
+func (t *terminal) close() {
+	t.restore()
+}
+
+func (t *terminal) readLine(prompt string) (string, error) {
+	buf := make([]rune, 0)
+	pos := 0
+	hist := len(t.history)
+
+	redraw := func() {
+		fmt.Fprintf(t.out, "\r%s%s\x1b[K", prompt, string(buf))
+		if n := len(buf) - pos; n > 0 {
+			fmt.Fprintf(t.out, "\x1b[%dD", n)
+		}
+	}
+	redraw()
+
+	for {
+		c, _, err := t.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch c {
+		case '\r', '\n':
+			fmt.Fprint(t.out, "\r\n")
+			line := string(buf)
+			if strings.TrimSpace(line) != "" {
+				t.history = append(t.history, line)
+			}
+			return line, nil
+		case 3: //Ctrl-C
+			fmt.Fprint(t.out, "^C\r\n")
+			buf, pos = buf[:0], 0
+		case 4: //Ctrl-D
+			if len(buf) == 0 {
+				fmt.Fprint(t.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case 127, 8: //退格
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case 1: //Ctrl-A
+			pos = 0
+		case 5: //Ctrl-E
+			pos = len(buf)
+		case 21: //Ctrl-U
+			buf = append(buf[:0], buf[pos:]...)
+			pos = 0
+		case '\t':
+			buf, pos = t.completeLine(buf, pos)
+		case 27: //方向键等转义序列
+			seq, err := t.escape()
+			if err != nil {
+				return "", err
+			}
+			switch seq {
+			case "[A", "[B":
+				if seq == "[A" && hist > 0 {
+					hist--
+				} else if seq == "[B" && hist < len(t.history) {
+					hist++
+				}
+				buf = buf[:0]
+				if hist < len(t.history) {
+					buf = append(buf, []rune(t.history[hist])...)
+				}
+				pos = len(buf)
+			case "[C":
+				if pos < len(buf) {
+					pos++
+				}
+			case "[D":
+				if pos > 0 {
+					pos--
+				}
+			case "[H", "OH", "[1~":
+				pos = 0
+			case "[F", "OF", "[4~":
+				pos = len(buf)
+			case "[3~":
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+				}
+			}
+		default:
+			if c >= 32 {
+				buf = append(buf[:pos], append([]rune{c}, buf[pos:]...)...)
+				pos++
+			}
+		}
+
+		redraw()
+	}
+}
+
+// 读取转义序列(ESC 之后的部分)
+func (t *terminal) escape() (string, error) {
+	seq := make([]rune, 0, 4)
+	for {
+		c, _, err := t.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		seq = append(seq, c)
+
+		//ESC [ 之后以字母或 ~ 结束, ESC O 之后为一个字母
+		if len(seq) >= 2 && (c == '~' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')) {
+			return string(seq), nil
+		}
+		if len(seq) == 1 && c != '[' && c != 'O' {
+			return string(seq), nil
+		}
+		if len(seq) > 8 {
+			return "", errors.New("invalid escape sequence")
+		}
+	}
+}
+
+// Tab 补全: 唯一候选时直接补全, 多个候选时补全公共前缀并列出候选
+func (t *terminal) completeLine(buf []rune, pos int) ([]rune, int) {
+	head := string(buf[:pos])
+	start, candidates := t.complete(head)
+	if len(candidates) == 0 {
+		return buf, pos
+	}
+
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+
+	if len(candidates) > 1 {
+		fmt.Fprint(t.out, "\r\n")
+		for _, c := range candidates {
+			fmt.Fprintf(t.out, "%s  ", strings.TrimRight(c, " "))
+		}
+		fmt.Fprint(t.out, "\r\n")
+	}
+
+	if utf8.RuneCountInString(prefix) < utf8.RuneCountInString(head[start:]) {
+		return buf, pos
+	}
+
+	newHead := []rune(head[:start] + prefix)
+	return append(newHead, buf[pos:]...), len(newHead)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lvxms/jsnx"
+)
+
+func newTestRepl(t *testing.T, doc string) *repl {
+	holder, err := jsnx.NewJsonHolder(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &repl{holder: holder, out: &bytes.Buffer{}}
+}
+
+func TestComplete(t *testing.T) {
+	r := newTestRepl(t, `{"server":{"host":"a","port":1},"services":[1,2],"name":"x","10":true}`)
+
+	tests := []struct {
+		line       string
+		start      int
+		candidates []string
+	}{
+		{"c", 0, []string{"cat ", "cd "}},
+		{"cat s", 4, []string{"server/", "services/"}},
+		{"cat server/", 4, []string{"server/host ", "server/port "}},
+		{"cat server/h", 4, []string{"server/host "}},
+		{"cd services/", 3, []string{"services/0 ", "services/1 "}},
+		{"cat 1", 4, nil},
+		{"cat \"1", 4, []string{"\"10\" "}},
+		{"cat missing/", 4, nil},
+	}
+
+	for _, tt := range tests {
+		start, candidates := r.complete(tt.line)
+		if len(candidates) == 0 {
+			candidates = nil
+		}
+		if start != tt.start || !reflect.DeepEqual(candidates, tt.candidates) {
+			t.Errorf("complete(%q) = %d %q, want %d %q", tt.line, start, candidates, tt.start, tt.candidates)
+		}
+	}
+}
+
+func TestCompleteLine(t *testing.T) {
+	r := newTestRepl(t, `{"server":{"host":"a","port":1},"services":[1,2]}`)
+
+	tests := []struct {
+		line   string
+		result string
+		listed string //列出的候选, 为空时不列出
+	}{
+		{"cat s", "cat serv", "server/  services/"},
+		{"cat server/h", "cat server/host ", ""},
+		{"cat server/", "cat server/", "server/host  server/port"},
+		{"cat x", "cat x", ""},
+	}
+
+	for _, tt := range tests {
+		out := &bytes.Buffer{}
+		term := &terminal{out: out, complete: r.complete}
+
+		buf := []rune(tt.line)
+		newBuf, pos := term.completeLine(buf, len(buf))
+		if string(newBuf) != tt.result || pos != len([]rune(tt.result)) {
+			t.Errorf("completeLine(%q) = %q %d, want %q", tt.line, string(newBuf), pos, tt.result)
+		}
+
+		listed := strings.TrimSpace(out.String())
+		if listed != tt.listed {
+			t.Errorf("completeLine(%q) listed %q, want %q", tt.line, listed, tt.listed)
+		}
+	}
+}
+
+// 光标之后的内容保留
+func TestCompleteLineMiddle(t *testing.T) {
+	r := newTestRepl(t, `{"server":{"host":"a"}}`)
+	term := &terminal{out: &bytes.Buffer{}, complete: r.complete}
+
+	buf := []rune("cat ser tail")
+	newBuf, pos := term.completeLine(buf, len("cat ser"))
+	if string(newBuf) != "cat server/ tail" || pos != len("cat server/") {
+		t.Errorf("completeLine = %q %d", string(newBuf), pos)
+	}
+}
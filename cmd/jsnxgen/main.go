@@ -0,0 +1,56 @@
+// jsnxgen 由样本JSON 文件生成Go 结构体定义
+//
+//	jsnxgen [-type Name] [-pkg main] [-o out.go] sample.json [sample2.json ...]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/lvxms/jsnx"
+)
+
+func main() {
+	typeName := flag.String("type", "Root", "root type name")
+	pkg := flag.String("pkg", "main", "package name, empty for no package clause")
+	out := flag.String("o", "", "output file, default stdout")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: jsnxgen [-type Name] [-pkg main] [-o out.go] sample.json [sample2.json ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	//多个样本合并推断
+	samples := make([]*jsnx.JsonHolder, 0, flag.NArg())
+	for _, file := range flag.Args() {
+		holder, err := jsnx.ParseFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "jsnxgen: %s: %v\n", file, err)
+			os.Exit(1)
+		}
+		samples = append(samples, holder)
+	}
+
+	src, err := jsnx.GenerateStructs(jsnx.InferSchema(samples...), *typeName, *pkg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "jsnxgen: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *out == "" {
+		os.Stdout.Write(src)
+		return
+	}
+
+	if err = ioutil.WriteFile(*out, src, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "jsnxgen: %v\n", err)
+		os.Exit(1)
+	}
+}
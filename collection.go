@@ -0,0 +1,310 @@
+package jsnx
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 排序键
+type SortKey struct {
+	Path string //元素内的路径, 为空时按元素本身排序
+	Desc bool   //降序
+}
+
+// 过滤数组元素; inPlace=true 时写回原数组, 否则返回新的holder(元素与原数据共享)
+func (holder *JsonHolder) Filter(path string, fn func(i int, node Node) bool, inPlace ...bool) (*JsonHolder, error) {
+	arryNode, items, err := holder.readArry(path, inPlace...)
+	if err != nil {
+		return nil, err
+	}
+
+	newNode := make(ArryNode, 0, len(items))
+	for i, item := range items {
+		if fn(i, item) {
+			newNode = append(newNode, item)
+		}
+	}
+
+	return holder.collResult(path, arryNode, newNode, inPlace...)
+}
+
+// 转换数组元素
+func (holder *JsonHolder) Map(path string, fn func(i int, node Node) (interface{}, error), inPlace ...bool) (*JsonHolder, error) {
+	arryNode, items, err := holder.readArry(path, inPlace...)
+	if err != nil {
+		return nil, err
+	}
+
+	newNode := make(ArryNode, len(items))
+	for i, item := range items {
+		newNode[i], err = fn(i, item)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return holder.collResult(path, arryNode, newNode, inPlace...)
+}
+
+// 按一个或多个键排序(稳定排序): null < bool < 数字 < 字符串 < 数组 < 对象
+func (holder *JsonHolder) Sort(path string, keys []SortKey, inPlace ...bool) (*JsonHolder, error) {
+	arryNode, items, err := holder.readArry(path, inPlace...)
+	if err != nil {
+		return nil, err
+	}
+
+	//预先取出排序键值
+	values := make([][]interface{}, len(items))
+	for i, item := range items {
+		values[i] = make([]interface{}, len(keys))
+		for k, key := range keys {
+			values[i][k] = elemValue(item, key.Path)
+		}
+	}
+
+	idx := make([]int, len(items))
+	for i := range idx {
+		idx[i] = i
+	}
+
+	sort.SliceStable(idx, func(a, b int) bool {
+		for k, key := range keys {
+			c := CompareNode(values[idx[a]][k], values[idx[b]][k])
+			if c == 0 {
+				continue
+			}
+			if key.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+
+	newNode := make(ArryNode, len(items))
+	for i, j := range idx {
+		newNode[i] = items[j]
+	}
+
+	return holder.collResult(path, arryNode, newNode, inPlace...)
+}
+
+// 按元素内的键值分组, 返回 {键值: [元素...]}
+func (holder *JsonHolder) GroupBy(path, keyPath string) (*JsonHolder, error) {
+	_, items, err := holder.readArry(path)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(MapNode)
+	for _, item := range items {
+		key := groupKey(elemValue(item, keyPath))
+		group, _ := groups[key].(ArryNode)
+		groups[key] = append(group, item)
+	}
+
+	return Holder(groups), nil
+}
+
+// 按元素内的键值去重, 保留第一次出现的元素
+func (holder *JsonHolder) Distinct(path, keyPath string, inPlace ...bool) (*JsonHolder, error) {
+	arryNode, items, err := holder.readArry(path, inPlace...)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(items))
+	newNode := make(ArryNode, 0, len(items))
+	for _, item := range items {
+		key, err := FormatJson(elemValue(item, keyPath), "")
+		if err != nil {
+			return nil, err
+		}
+
+		if !seen[key] {
+			seen[key] = true
+			newNode = append(newNode, item)
+		}
+	}
+
+	return holder.collResult(path, arryNode, newNode, inPlace...)
+}
+
+// 截取数组 [start, end); end<0 或超出长度时截取到末尾
+func (holder *JsonHolder) Slice(path string, start, end int, inPlace ...bool) (*JsonHolder, error) {
+	arryNode, items, err := holder.readArry(path, inPlace...)
+	if err != nil {
+		return nil, err
+	}
+
+	if end < 0 || end > len(items) {
+		end = len(items)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > end {
+		start = end
+	}
+
+	return holder.collResult(path, arryNode, items[start:end], inPlace...)
+}
+
+// 取数组前n 个元素
+func (holder *JsonHolder) Limit(path string, n int, inPlace ...bool) (*JsonHolder, error) {
+	if n < 0 {
+		n = 0
+	}
+
+	return holder.Slice(path, 0, n, inPlace...)
+}
+
+// 返回新holder 或写回原数组
+func (holder *JsonHolder) collResult(path string, oldNode Node, newNode ArryNode, inPlace ...bool) (*JsonHolder, error) {
+	if len(inPlace) > 0 && inPlace[0] {
+		err := holder.replaceArry(path, oldNode, newNode)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return Holder(newNode), nil
+}
+
+// 用新数组替换原数组(一次写锁内完成): 读取后数组被其它操作修改时返回错误;
+// oldNode 需在冻结的数据上读取(见readArry), 内容相同时视为未修改
+func (holder *JsonHolder) replaceArry(path string, oldNode Node, newNode ArryNode) error {
+	holder.mu.Lock()
+	oldData := holder.beginWrite()
+
+	curNode, err := holder.get(path)
+	if err == nil && !equalNode(curNode, oldNode) {
+		err = fmt.Errorf("Node[%s] changed during processing", path)
+	}
+	if err == nil {
+		err = holder.replace(path, newNode)
+	}
+	ev := ChangeEvent{Path: cleanPath(path), Op: OpReplace, OldValue: oldNode, NewValue: newNode}
+	if err == nil {
+		err = holder.endWrite(oldData, OpReplace+" "+cleanPath(path), ev)
+	}
+	holder.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	holder.notify(ev)
+	return nil
+}
+
+// 取元素内指定路径的值, 路径无效时返回nil
+func elemValue(item Node, path string) Node {
+	if strings.Trim(path, "/") == "" {
+		return item
+	}
+
+	node, err := Holder(item).get(path)
+	if err != nil {
+		return nil
+	}
+
+	return node
+}
+
+// 分组键值: 字符串直接使用, 其它转换为JSON
+func groupKey(node Node) string {
+	if s, ok := node.(string); ok {
+		return s
+	}
+
+	data, err := json.Marshal(node)
+	if err != nil {
+		return fmt.Sprint(node)
+	}
+
+	return string(data)
+}
+
+// 结点类型排序序号
+func nodeRank(node Node) int {
+	switch node.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case int, int64, float64, json.Number:
+		return 2
+	case string:
+		return 3
+	case ArryNode, ArryMapNode:
+		return 4
+	case MapNode:
+		return 5
+	}
+
+	return 6
+}
+
+// 比较两个结点: 不同类型按 null < bool < 数字 < 字符串 < 数组 < 对象,
+// 同类型数字按数值, 字符串按字典序, 数组逐个元素比较, 其它按JSON 文本比较
+func CompareNode(a, b Node) int {
+	ra, rb := nodeRank(a), nodeRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+
+	switch ra {
+	case 0:
+		return 0
+	case 1:
+		ba, bb := a.(bool), b.(bool)
+		if ba == bb {
+			return 0
+		}
+		if !ba {
+			return -1
+		}
+		return 1
+	case 2:
+		fa, _ := toFloat(a)
+		fb, _ := toFloat(b)
+		if fa < fb {
+			return -1
+		}
+		if fa > fb {
+			return 1
+		}
+		return 0
+	case 3:
+		return strings.Compare(a.(string), b.(string))
+	case 4:
+		na, _ := asArry(a)
+		nb, _ := asArry(b)
+		for i := 0; i < len(na) && i < len(nb); i++ {
+			if c := CompareNode(na[i], nb[i]); c != 0 {
+				return c
+			}
+		}
+		return compareInt(len(na), len(nb))
+	}
+
+	sa, _ := FormatJson(a, "")
+	sb, _ := FormatJson(b, "")
+	return strings.Compare(sa, sb)
+}
+
+func compareInt(a, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,428 @@
+package jsnx
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 配置来源
+const (
+	SourceDefault = "default" //默认值
+	SourceFile    = "file"    //配置文件, 来源为 file:<文件名>
+	SourceEnv     = "env"     //环境变量, 来源为 env:<变量名>
+	SourceFlag    = "flag"    //命令行参数, 来源为 flag:--<参数名>
+)
+
+// 分层加载配置: 按添加顺序叠加默认值、配置文件、环境变量及命令行参数, 后加的覆盖先加的;
+// 对象逐个键值合并, 其它结点整体替换; 环境变量及命令行参数的字符串值转换为已有值的类型
+type ConfigLoader struct {
+	layers      []configLayer
+	interpolate bool
+}
+
+// 配置层
+type configLayer func(b *configBuilder) error
+
+// 加载后的配置, 记录每个叶子结点的来源
+type Config struct {
+	*JsonHolder
+	Unresolved []UnresolvedRef //加载时解析引用未能解析的引用
+
+	origins map[string]configOrigin
+}
+
+type configOrigin struct {
+	source string
+	seq    int //设置顺序
+}
+
+func NewConfigLoader() *ConfigLoader {
+	return &ConfigLoader{}
+}
+
+// 默认值
+func (l *ConfigLoader) Defaults(holder *JsonHolder) *ConfigLoader {
+	l.layers = append(l.layers, func(b *configBuilder) error {
+		holder.mu.RLock()
+		data := cloneNode(holder.Data)
+		holder.mu.RUnlock()
+
+		b.merge("/", data, SourceDefault)
+		return nil
+	})
+	return l
+}
+
+// 配置文件; optional=true 时文件不存在不报错
+func (l *ConfigLoader) File(path string, optional ...bool) *ConfigLoader {
+	l.layers = append(l.layers, func(b *configBuilder) error {
+		holder, err := ParseFile(path)
+		if err != nil {
+			if os.IsNotExist(err) && len(optional) > 0 && optional[0] {
+				return nil
+			}
+			return err
+		}
+
+		b.merge("/", holder.Data, SourceFile+":"+path)
+		return nil
+	})
+	return l
+}
+
+// 环境变量: prefix_A__B 对应路径 /a/b (双下划线分隔层级, 键值不区分大小写, 新键值为小写)
+func (l *ConfigLoader) Env(prefix string) *ConfigLoader {
+	l.layers = append(l.layers, func(b *configBuilder) error {
+		environ := os.Environ()
+		sort.Strings(environ)
+
+		for _, kv := range environ {
+			idx := strings.Index(kv, "=")
+			if idx < 0 || !strings.HasPrefix(kv[:idx], prefix+"_") {
+				continue
+			}
+
+			name := kv[:idx]
+			keys := strings.Split(strings.TrimPrefix(name, prefix+"_"), "__")
+			if err := b.set(keys, kv[idx+1:], SourceEnv+":"+name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return l
+}
+
+// 命令行参数: --a.b=value, --a.b value 或 --/a/b=value; 值可以是负数(--port -1);
+// 已有值为bool 时不取下一个参数作为值, 不带值时为true(false 需写为 --a.b=false);
+// 单横线参数及非参数忽略, "--" 之后不再处理
+func (l *ConfigLoader) Flags(args []string) *ConfigLoader {
+	l.layers = append(l.layers, func(b *configBuilder) error {
+		for i := 0; i < len(args); i++ {
+			arg := args[i]
+			if arg == "--" {
+				break
+			}
+			if !strings.HasPrefix(arg, "--") {
+				continue
+			}
+
+			name, value := arg[2:], "true"
+			if idx := strings.Index(name, "="); idx >= 0 {
+				name, value = name[:idx], name[idx+1:]
+			} else if i+1 < len(args) && isFlagValue(args[i+1]) {
+				if _, old, err := b.resolve(flagKeys(name)); err == nil {
+					if _, isBool := old.(bool); !isBool {
+						i++
+						value = args[i]
+					}
+				}
+			}
+
+			if err := b.set(flagKeys(name), value, SourceFlag+":--"+name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return l
+}
+
+// 命令行参数(flag 包): 只取已设置的参数, 参数名 a.b 对应路径 /a/b
+func (l *ConfigLoader) FlagSet(fs *flag.FlagSet) *ConfigLoader {
+	l.layers = append(l.layers, func(b *configBuilder) error {
+		var err error
+		fs.Visit(func(f *flag.Flag) {
+			if err == nil {
+				err = b.set(flagKeys(f.Name), f.Value.String(), SourceFlag+":--"+f.Name)
+			}
+		})
+		return err
+	})
+	return l
+}
+
+// 叠加后解析字符串值中的引用, 见JsonHolder.Interpolate
+func (l *ConfigLoader) Interpolate() *ConfigLoader {
+	l.interpolate = true
+	return l
+}
+
+// 可以作为参数值: 不以 - 开头或为负数
+func isFlagValue(arg string) bool {
+	if !strings.HasPrefix(arg, "-") {
+		return true
+	}
+
+	_, err := strconv.ParseFloat(arg, 64)
+	return err == nil
+}
+
+func flagKeys(name string) []string {
+	if strings.HasPrefix(name, "/") {
+		return pathKeys(name)
+	}
+
+	return strings.Split(name, ".")
+}
+
+// 按顺序叠加各层配置
+func (l *ConfigLoader) Load() (*Config, error) {
+	b := &configBuilder{data: MapNode{}, origins: make(map[string]configOrigin)}
+
+	for _, layer := range l.layers {
+		if err := layer(b); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := &Config{JsonHolder: &JsonHolder{Data: b.data}, origins: b.origins}
+	if l.interpolate {
+		ip := newInterpolator(b.data)
+		cfg.Data = ip.run("/", b.data)
+		cfg.Unresolved = ip.unresolved
+	}
+
+	return cfg, nil
+}
+
+// 叠加配置时的中间状态
+type configBuilder struct {
+	data    Node
+	origins map[string]configOrigin
+	seq     int
+}
+
+// 合并结点: 双方都是对象时逐个键值合并, 否则替换
+func (b *configBuilder) merge(path string, src Node, source string) {
+	holder := &JsonHolder{Data: b.data}
+	dst, _ := holder.lookup(path)
+
+	srcMap, ok := src.(MapNode)
+	if dstMap, ok2 := dst.(MapNode); ok && ok2 {
+		for key, value := range srcMap {
+			if _, exist := dstMap[key]; !exist {
+				dstMap[key] = nil
+			}
+			b.merge(joinKey(path, key), value, source)
+		}
+		return
+	}
+
+	if path == "/" {
+		b.data = src
+	} else {
+		holder.replace(path, src)
+	}
+	b.record(path, src, source)
+}
+
+// 记录结点下所有叶子的来源(替换原有记录)
+func (b *configBuilder) record(path string, node Node, source string) {
+	for key := range b.origins {
+		if key == path || path == "/" || strings.HasPrefix(key, path+"/") {
+			delete(b.origins, key)
+		}
+	}
+
+	b.seq++
+	var walk func(path string, node Node)
+	walk = func(path string, node Node) {
+		switch n := node.(type) {
+		case MapNode:
+			if len(n) > 0 {
+				for key, value := range n {
+					walk(joinKey(path, key), value)
+				}
+				return
+			}
+		case ArryNode, ArryMapNode:
+			if items, _ := asArry(n); len(items) > 0 {
+				for i, value := range items {
+					walk(joinIndex(path, i), value)
+				}
+				return
+			}
+		}
+		b.origins[path] = configOrigin{source: source, seq: b.seq}
+	}
+	walk(path, node)
+}
+
+// 设置字符串值: 键值按已有键值匹配(不区分大小写), 值转换为已有值的类型
+func (b *configBuilder) set(keys []string, value, source string) error {
+	path, _, err := b.resolve(keys)
+	if err != nil {
+		return fmt.Errorf("%s: %v", source, err)
+	}
+
+	holder := &JsonHolder{Data: b.data}
+	oldNode, exist := holder.lookup(path)
+	newNode, err := coerceValue(oldNode, value)
+	if err != nil {
+		return fmt.Errorf("Path(%v) %s: %v", path, source, err)
+	}
+
+	if exist {
+		err = holder.replace(path, newNode)
+	} else {
+		err = holder.setJson(path, newNode)
+	}
+	if err != nil {
+		return fmt.Errorf("Path(%v) %s: %v", path, source, err)
+	}
+
+	b.data = holder.Data
+	b.record(path, newNode, source)
+	return nil
+}
+
+// 按已有键值(不区分大小写)解析路径, 返回路径及已有结点(不存在时为nil)
+func (b *configBuilder) resolve(keys []string) (string, Node, error) {
+	path := "/"
+	node := b.data
+	for _, key := range keys {
+		if key == "" {
+			return "", nil, fmt.Errorf("empty key")
+		}
+
+		var child Node
+		if items, ok := asArry(node); ok && arryIndex(key) >= 0 {
+			if idx := arryIndex(key); idx < len(items) {
+				child = items[idx]
+			}
+			path = joinIndex(path, arryIndex(key))
+		} else {
+			newKey := strings.ToLower(key)
+			if mapNode, ok := node.(MapNode); ok {
+				for k, v := range mapNode {
+					if strings.EqualFold(k, key) {
+						newKey, child = k, v
+						break
+					}
+				}
+			}
+			path = joinKey(path, newKey)
+		}
+		node = child
+	}
+
+	return path, node, nil
+}
+
+// 将字符串转换为已有值的类型; 没有已有值(或为null)时为字符串,
+// 对象及数组需要JSON, 数组也可以用逗号分隔(元素类型同原数组第一个元素)
+func coerceValue(old Node, value string) (Node, error) {
+	switch n := old.(type) {
+	case nil, string:
+		return value, nil
+	case bool:
+		return strconv.ParseBool(value)
+	case float64:
+		return strconv.ParseFloat(value, 64)
+	case int:
+		i, err := strconv.ParseInt(value, 10, 0)
+		return int(i), err
+	case int64:
+		return strconv.ParseInt(value, 10, 64)
+	case json.Number:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, err
+		}
+		return json.Number(value), nil
+	case MapNode:
+		var node Node
+		if err := json.Unmarshal([]byte(value), &node); err != nil {
+			return nil, err
+		}
+		if _, ok := node.(MapNode); !ok {
+			return nil, fmt.Errorf("not an object")
+		}
+		return node, nil
+	case ArryNode, ArryMapNode:
+		var node Node
+		if strings.HasPrefix(strings.TrimSpace(value), "[") {
+			if err := json.Unmarshal([]byte(value), &node); err != nil {
+				return nil, err
+			}
+			return node, nil
+		}
+
+		var elem Node
+		if items, _ := asArry(n); len(items) > 0 {
+			elem = items[0]
+		}
+		items := make(ArryNode, 0)
+		for _, item := range strings.Split(value, ",") {
+			v, err := coerceValue(elem, strings.TrimSpace(item))
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %T", old)
+}
+
+// 结点的来源: 叶子结点为设置它的配置层, 对象/数组为其中最后设置的叶子结点的来源; 未知时为空.
+// 来源在Load 时记录, 之后用SetJson 等修改配置不会更新来源
+func (c *Config) WhereFrom(path string) string {
+	path = cleanPath(path)
+
+	if origin, ok := c.origins[path]; ok {
+		return origin.source
+	}
+
+	var latest *configOrigin
+	for key, origin := range c.origins {
+		if path == "/" || strings.HasPrefix(key, path+"/") {
+			if latest == nil || origin.seq > latest.seq {
+				o := origin
+				latest = &o
+			}
+		}
+	}
+	if latest == nil {
+		return ""
+	}
+
+	return latest.source
+}
+
+// 输出生效的配置: 每行一个叶子结点 "路径 = 值  # 来源", 按路径排序
+func (c *Config) Dump() string {
+	flat, err := c.Flatten("/", "/", FlatIndex)
+	if err != nil {
+		return ""
+	}
+
+	paths := make([]string, 0, len(flat))
+	for path := range flat {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	buff := strings.Builder{}
+	for _, path := range paths {
+		value, err := FormatJson(flat[path], "")
+		if err != nil {
+			value = fmt.Sprint(flat[path])
+		}
+
+		path = "/" + path
+		fmt.Fprintf(&buff, "%s = %s", path, value)
+		if source := c.WhereFrom(path); source != "" {
+			fmt.Fprintf(&buff, "  # %s", source)
+		}
+		buff.WriteString("\n")
+	}
+
+	return buff.String()
+}
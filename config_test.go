@@ -0,0 +1,194 @@
+package jsnx
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testDefaults(t *testing.T) *JsonHolder {
+	holder, err := NewJsonHolder(`{"server":{"host":"localhost","port":80,"debug":false,"tags":["a"]},"ratio":0.5,"name":"x"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return holder
+}
+
+func TestConfigEnv(t *testing.T) {
+	t.Setenv("TESTAPP_SERVER__PORT", "8080")
+	t.Setenv("TESTAPP_SERVER__DEBUG", "true")
+	t.Setenv("TESTAPP_SERVER__TAGS", "b, c")
+	t.Setenv("TESTAPP_RATIO", "0.25")
+	t.Setenv("TESTAPP_NEW__KEY", "v")
+
+	cfg, err := NewConfigLoader().Defaults(testDefaults(t)).Env("TESTAPP").Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//转换为已有值的类型, 键值不区分大小写, 新键值为小写
+	tests := []struct {
+		path string
+		want Node
+	}{
+		{"/server/port", 8080.0},
+		{"/server/debug", true},
+		{"/server/tags", ArryNode{"b", "c"}},
+		{"/ratio", 0.25},
+		{"/new/key", "v"},
+		{"/server/host", "localhost"},
+	}
+	for _, tt := range tests {
+		got, err := cfg.Get(tt.path)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, %v, want %#v", tt.path, got, err, tt.want)
+		}
+	}
+
+	if from := cfg.WhereFrom("/server/port"); from != "env:TESTAPP_SERVER__PORT" {
+		t.Errorf("WhereFrom(/server/port) = %q", from)
+	}
+	if from := cfg.WhereFrom("/server/host"); from != SourceDefault {
+		t.Errorf("WhereFrom(/server/host) = %q", from)
+	}
+
+	t.Setenv("TESTAPP_SERVER__PORT", "eighty")
+	if _, err = NewConfigLoader().Defaults(testDefaults(t)).Env("TESTAPP").Load(); err == nil {
+		t.Error("invalid number accepted")
+	}
+}
+
+func TestConfigFlags(t *testing.T) {
+	args := []string{
+		"--server.port", "-1",
+		"--server.debug", "extra",
+		"--ratio=-0.5",
+		"--/server/host=example.com",
+		"-v",
+		"--name", "--other",
+		"--", "--server.port=2",
+	}
+
+	cfg, err := NewConfigLoader().Defaults(testDefaults(t)).Flags(args).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//负数作为值; bool 不取下一个参数; 下一个参数是参数时为true
+	tests := []struct {
+		path string
+		want Node
+	}{
+		{"/server/port", -1.0},
+		{"/server/debug", true},
+		{"/ratio", -0.5},
+		{"/server/host", "example.com"},
+		{"/name", "true"},
+		{"/other", "true"},
+	}
+	for _, tt := range tests {
+		got, err := cfg.Get(tt.path)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, %v, want %#v", tt.path, got, err, tt.want)
+		}
+	}
+	if _, exist := cfg.Lookup("/extra"); exist {
+		t.Error("non-flag argument used as key")
+	}
+
+	if from := cfg.WhereFrom("/server/port"); from != "flag:--server.port" {
+		t.Errorf("WhereFrom(/server/port) = %q", from)
+	}
+
+	_, err = NewConfigLoader().Defaults(testDefaults(t)).Flags([]string{"--server.debug=maybe"}).Load()
+	if err == nil {
+		t.Error("invalid bool accepted")
+	}
+}
+
+func TestConfigFlagSet(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("server.port", 1, "")
+	fs.String("server.host", "unset", "")
+	if err := fs.Parse([]string{"-server.port", "9090"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := NewConfigLoader().Defaults(testDefaults(t)).FlagSet(fs).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//只取已设置的参数
+	if port, _ := cfg.GetInt("/server/port"); port != 9090 {
+		t.Errorf("port = %d", port)
+	}
+	if host, _ := cfg.GetString("/server/host"); host != "localhost" {
+		t.Errorf("host = %q", host)
+	}
+}
+
+// 后加的层覆盖先加的, 对象逐个键值合并; 对象的来源为最后设置的叶子结点的来源
+func TestConfigProvenance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.json")
+	if err := os.WriteFile(path, []byte(`{"server":{"host":"file.host"},"extra":[1,2]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TESTPROV_NAME", "env")
+
+	cfg, err := NewConfigLoader().
+		Defaults(testDefaults(t)).
+		File(path).
+		File(filepath.Join(t.TempDir(), "missing.json"), true).
+		Env("TESTPROV").
+		Flags([]string{"--server.port=81"}).
+		Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path, from string
+	}{
+		{"/server/host", "file:" + path},
+		{"/server/port", "flag:--server.port"},
+		{"/server/debug", SourceDefault},
+		{"/server", "flag:--server.port"},
+		{"/extra", "file:" + path},
+		{"/extra/0", "file:" + path},
+		{"/name", "env:TESTPROV_NAME"},
+		{"/", "flag:--server.port"},
+		{"/missing", ""},
+	}
+	for _, tt := range tests {
+		if from := cfg.WhereFrom(tt.path); from != tt.from {
+			t.Errorf("WhereFrom(%s) = %q, want %q", tt.path, from, tt.from)
+		}
+	}
+
+	dump := cfg.Dump()
+	for _, line := range []string{
+		`/server/host = "file.host"  # file:` + path,
+		`/server/port = 81  # flag:--server.port`,
+		`/extra/1 = 2  # file:` + path,
+		`/name = "env"  # env:TESTPROV_NAME`,
+	} {
+		if !strings.Contains(dump, line+"\n") {
+			t.Errorf("Dump missing %q:\n%s", line, dump)
+		}
+	}
+
+	//Load 之后的修改不更新来源
+	cfg.SetJson("/server/host", "changed")
+	if from := cfg.WhereFrom("/server/host"); from != "file:"+path {
+		t.Errorf("WhereFrom after SetJson = %q", from)
+	}
+
+	if _, err = NewConfigLoader().File(filepath.Join(t.TempDir(), "missing.json")).Load(); err == nil {
+		t.Error("missing required file accepted")
+	}
+}
@@ -0,0 +1,1318 @@
+package jsnx
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 表达式, 标识符为holder 中的路径:
+//
+//	/a/0/b 或 a.b[0]   路径(与Get 规则相同), 路径不存在时为null
+//	$                  当前结点本身
+//	x.key x?.key x[i]  取值, x 为null 或不是容器时结果为null
+//	+ - * / %          算术, + 两边有字符串时为拼接; 有null 时结果为null
+//	== != < <= > >=    比较
+//	&& || ! ?:         逻辑及条件
+//	fn(args...)        函数: len coalesce upper lower trim contains startsWith endsWith
+//	                   substr replace split join concat matches str num int abs round floor ceil min max
+type Expr struct {
+	src   string
+	root  exprNode
+	paths []string
+}
+
+// 表达式错误
+type ExprError struct {
+	Src string
+	Pos int //出错位置(字节偏移)
+	Msg string
+}
+
+func (e *ExprError) Error() string {
+	col := utf8.RuneCountInString(e.Src[:e.Pos])
+	return fmt.Sprintf("expr: %s at column %d\n  %s\n  %s^", e.Msg, col+1, e.Src, strings.Repeat(" ", col))
+}
+
+// 编译表达式
+func CompileExpr(src string) (*Expr, error) {
+	p := &exprParser{lex: &exprLexer{src: src}, regexps: &exprRegexps{m: make(map[string]*regexp.Regexp)}}
+	p.next()
+
+	root, err := p.parseExpr(0)
+	if err == nil {
+		err = p.err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf(p.tok.pos, "unexpected %s", p.tok)
+	}
+
+	paths := make([]string, 0)
+	collectPaths(root, &paths)
+	return &Expr{src: src, root: root, paths: paths}, nil
+}
+
+// 编译表达式, 出错时panic
+func MustCompileExpr(src string) *Expr {
+	e, err := CompileExpr(src)
+	if err != nil {
+		panic(err)
+	}
+
+	return e
+}
+
+// 表达式原文
+func (e *Expr) String() string {
+	return e.src
+}
+
+// 表达式引用的路径
+func (e *Expr) Paths() []string {
+	return append([]string(nil), e.paths...)
+}
+
+// 以holder 的数据计算表达式
+func (e *Expr) Eval(holder *JsonHolder) (interface{}, error) {
+	holder.mu.RLock()
+	defer holder.mu.RUnlock()
+
+	return e.EvalNode(holder.Data)
+}
+
+// 以结点数据计算表达式
+func (e *Expr) EvalNode(node Node) (interface{}, error) {
+	return e.root.eval(node)
+}
+
+// 计算表达式并按真值返回: null/false/0/""/空数组/空对象 为false
+func (e *Expr) EvalBool(holder *JsonHolder) (bool, error) {
+	v, err := e.Eval(holder)
+	if err != nil {
+		return false, err
+	}
+
+	return truthy(v), nil
+}
+
+// 计算表达式
+func (holder *JsonHolder) Eval(expr string) (interface{}, error) {
+	e, err := CompileExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.Eval(holder)
+}
+
+// 按表达式过滤数组元素, 表达式中的路径相对于元素
+func (holder *JsonHolder) FilterExpr(path, expr string, inPlace ...bool) (*JsonHolder, error) {
+	e, err := CompileExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	arryNode, items, err := holder.readArry(path, inPlace...)
+	if err != nil {
+		return nil, err
+	}
+
+	//全部元素计算成功后才写回, 计算出错时不修改holder
+	newNode := make(ArryNode, 0, len(items))
+	for i, item := range items {
+		v, err := e.EvalNode(item)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %v", i, err)
+		}
+		if truthy(v) {
+			newNode = append(newNode, item)
+		}
+	}
+
+	return holder.collResult(path, arryNode, newNode, inPlace...)
+}
+
+//
+// 词法分析
+//
+
+const (
+	tokEOF = iota
+	tokNumber
+	tokString
+	tokPath
+	tokIdent
+	tokOp
+)
+
+type exprToken struct {
+	kind int
+	pos  int
+	text string
+	num  float64
+}
+
+func (t exprToken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+
+	return "'" + t.text + "'"
+}
+
+type exprLexer struct {
+	src  string
+	pos  int
+	prev exprToken
+}
+
+// 上一个token 是否为操作数结尾, 是则 / 为除号, 否则为路径开始
+func (lx *exprLexer) afterOperand() bool {
+	switch lx.prev.kind {
+	case tokNumber, tokString, tokPath, tokIdent:
+		return true
+	case tokOp:
+		return lx.prev.text == ")" || lx.prev.text == "]"
+	}
+
+	return false
+}
+
+func (lx *exprLexer) next() (exprToken, error) {
+	tok, err := lx.scan()
+	if err == nil {
+		lx.prev = tok
+	}
+
+	return tok, err
+}
+
+func (lx *exprLexer) scan() (exprToken, error) {
+	for lx.pos < len(lx.src) && (lx.src[lx.pos] == ' ' || lx.src[lx.pos] == '\t' ||
+		lx.src[lx.pos] == '\n' || lx.src[lx.pos] == '\r') {
+		lx.pos++
+	}
+
+	start := lx.pos
+	if lx.pos >= len(lx.src) {
+		return exprToken{kind: tokEOF, pos: start}, nil
+	}
+
+	c := lx.src[lx.pos]
+	switch {
+	case c >= '0' && c <= '9':
+		return lx.scanNumber()
+	case c == '"' || c == '\'':
+		s, err := lx.scanString(c)
+		return exprToken{kind: tokString, pos: start, text: s}, err
+	case c == '/' && !lx.afterOperand():
+		return lx.scanPath()
+	case lx.identAt(lx.pos) > 0 && !(c >= '0' && c <= '9'):
+		for n := lx.identAt(lx.pos); n > 0; n = lx.identAt(lx.pos) {
+			lx.pos += n
+		}
+		return exprToken{kind: tokIdent, pos: start, text: lx.src[start:lx.pos]}, nil
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "?."} {
+		if strings.HasPrefix(lx.src[lx.pos:], op) {
+			lx.pos += len(op)
+			return exprToken{kind: tokOp, pos: start, text: op}, nil
+		}
+	}
+
+	if strings.ContainsRune("+-*/%<>!?:()[],.", rune(c)) {
+		lx.pos++
+		return exprToken{kind: tokOp, pos: start, text: string(c)}, nil
+	}
+
+	return exprToken{}, &ExprError{Src: lx.src, Pos: start, Msg: fmt.Sprintf("unexpected character %q", c)}
+}
+
+// 指定位置的标识符字符(字母、数字、下划线、$)的字节数, 不是时返回0
+func (lx *exprLexer) identAt(pos int) int {
+	if pos >= len(lx.src) {
+		return 0
+	}
+
+	r, size := utf8.DecodeRuneInString(lx.src[pos:])
+	if r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+		return size
+	}
+
+	return 0
+}
+
+func (lx *exprLexer) scanNumber() (exprToken, error) {
+	start := lx.pos
+	for lx.pos < len(lx.src) && (lx.src[lx.pos] >= '0' && lx.src[lx.pos] <= '9' || lx.src[lx.pos] == '.') {
+		lx.pos++
+	}
+
+	//指数部分
+	if lx.pos < len(lx.src) && (lx.src[lx.pos] == 'e' || lx.src[lx.pos] == 'E') {
+		lx.pos++
+		if lx.pos < len(lx.src) && (lx.src[lx.pos] == '+' || lx.src[lx.pos] == '-') {
+			lx.pos++
+		}
+		for lx.pos < len(lx.src) && lx.src[lx.pos] >= '0' && lx.src[lx.pos] <= '9' {
+			lx.pos++
+		}
+	}
+
+	text := lx.src[start:lx.pos]
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return exprToken{}, &ExprError{Src: lx.src, Pos: start, Msg: fmt.Sprintf("invalid number %q", text)}
+	}
+
+	return exprToken{kind: tokNumber, pos: start, text: text, num: f}, nil
+}
+
+func (lx *exprLexer) scanString(quote byte) (string, error) {
+	start := lx.pos
+	buff := strings.Builder{}
+
+	lx.pos++
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		if c == quote {
+			lx.pos++
+			return buff.String(), nil
+		}
+
+		if c == '\\' && lx.pos+1 < len(lx.src) {
+			lx.pos++
+			switch e := lx.src[lx.pos]; e {
+			case 'n':
+				buff.WriteByte('\n')
+			case 't':
+				buff.WriteByte('\t')
+			case 'r':
+				buff.WriteByte('\r')
+			case 'u':
+				if lx.pos+4 >= len(lx.src) {
+					return "", &ExprError{Src: lx.src, Pos: lx.pos, Msg: "invalid unicode escape"}
+				}
+				r, err := strconv.ParseUint(lx.src[lx.pos+1:lx.pos+5], 16, 32)
+				if err != nil {
+					return "", &ExprError{Src: lx.src, Pos: lx.pos, Msg: "invalid unicode escape"}
+				}
+				buff.WriteRune(rune(r))
+				lx.pos += 4
+			default:
+				buff.WriteByte(e)
+			}
+			lx.pos++
+			continue
+		}
+
+		buff.WriteByte(c)
+		lx.pos++
+	}
+
+	return "", &ExprError{Src: lx.src, Pos: start, Msg: "string not closed"}
+}
+
+// 路径: /seg/seg, 一级为字母数字下划线或带双引号的键值
+func (lx *exprLexer) scanPath() (exprToken, error) {
+	start := lx.pos
+
+	for lx.pos < len(lx.src) && lx.src[lx.pos] == '/' {
+		if lx.pos+1 >= len(lx.src) {
+			break
+		}
+
+		c := lx.src[lx.pos+1]
+		if c == '"' {
+			end := strings.IndexByte(lx.src[lx.pos+2:], '"')
+			if end < 0 {
+				return exprToken{}, &ExprError{Src: lx.src, Pos: lx.pos + 1, Msg: "path key quote not closed"}
+			}
+			lx.pos += end + 3
+			continue
+		}
+
+		if lx.identAt(lx.pos+1) == 0 {
+			break
+		}
+
+		lx.pos++
+		for n := lx.identAt(lx.pos); n > 0; n = lx.identAt(lx.pos) {
+			lx.pos += n
+		}
+	}
+
+	if lx.pos == start {
+		//单独的 / 表示根结点
+		lx.pos++
+	}
+
+	return exprToken{kind: tokPath, pos: start, text: lx.src[start:lx.pos]}, nil
+}
+
+//
+// 语法分析(优先级爬升)
+//
+
+type exprParser struct {
+	lex     *exprLexer
+	tok     exprToken
+	err     error
+	regexps *exprRegexps
+}
+
+func (p *exprParser) next() {
+	if p.err != nil {
+		return
+	}
+
+	p.tok, p.err = p.lex.next()
+	if p.err != nil {
+		p.tok = exprToken{kind: tokEOF, pos: p.lex.pos}
+	}
+}
+
+// 字节偏移转换为列号(按字符计, 从0开始), 与ExprError 一致
+func (p *exprParser) col(pos int) int {
+	return utf8.RuneCountInString(p.lex.src[:pos])
+}
+
+func (p *exprParser) errorf(pos int, format string, args ...interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	return &ExprError{Src: p.lex.src, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *exprParser) isOp(text string) bool {
+	return p.tok.kind == tokOp && p.tok.text == text
+}
+
+func (p *exprParser) expect(text string) error {
+	if !p.isOp(text) {
+		return p.errorf(p.tok.pos, "expected '%s' but found %s", text, p.tok)
+	}
+
+	p.next()
+	return nil
+}
+
+// 二元运算符优先级
+var binaryPrec = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+func (p *exprParser) parseExpr(minPrec int) (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if p.isOp("?") && minPrec == 0 {
+			//条件表达式, 优先级最低, 右结合
+			pos := p.tok.pos
+			p.next()
+			a, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(":"); err != nil {
+				return nil, err
+			}
+			b, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+			left = &condExpr{col: p.col(pos), cond: left, a: a, b: b}
+			continue
+		}
+
+		prec, ok := binaryPrec[p.tok.text]
+		if p.tok.kind != tokOp || !ok || prec <= minPrec {
+			return left, nil
+		}
+
+		op := p.tok
+		p.next()
+		right, err := p.parseExpr(prec)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{col: p.col(op.pos), op: op.text, l: left, r: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.isOp("!") || p.isOp("-") {
+		op := p.tok
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{col: p.col(op.pos), op: op.text, x: x}, nil
+	}
+
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch {
+		case p.isOp(".") || p.isOp("?."):
+			p.next()
+			if p.tok.kind != tokIdent {
+				return nil, p.errorf(p.tok.pos, "expected key name but found %s", p.tok)
+			}
+			x = memberOf(x, p.col(p.tok.pos), &literalExpr{value: p.tok.text})
+			p.next()
+		case p.isOp("["):
+			pos := p.tok.pos
+			p.next()
+			key, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = memberOf(x, p.col(pos), key)
+		default:
+			return x, nil
+		}
+	}
+}
+
+// 路径后面的常量键值直接拼接到路径中
+func memberOf(x exprNode, col int, key exprNode) exprNode {
+	if px, ok := x.(*pathExpr); ok {
+		if lit, ok := key.(*literalExpr); ok {
+			switch k := lit.value.(type) {
+			case string:
+				if !strings.ContainsAny(k, "/\"") {
+					return &pathExpr{path: joinKey(px.path, k)}
+				}
+			case float64:
+				if k >= 0 && k == math.Trunc(k) {
+					return &pathExpr{path: joinIndex(px.path, int(k))}
+				}
+			}
+		}
+	}
+
+	return &memberExpr{col: col, x: x, key: key}
+}
+
+// 收集表达式中引用的路径
+func collectPaths(node exprNode, paths *[]string) {
+	switch x := node.(type) {
+	case *pathExpr:
+		if x.path != "" {
+			*paths = append(*paths, cleanPath(x.path))
+		}
+	case *memberExpr:
+		collectPaths(x.x, paths)
+		collectPaths(x.key, paths)
+	case *unaryExpr:
+		collectPaths(x.x, paths)
+	case *binaryExpr:
+		collectPaths(x.l, paths)
+		collectPaths(x.r, paths)
+	case *condExpr:
+		collectPaths(x.cond, paths)
+		collectPaths(x.a, paths)
+		collectPaths(x.b, paths)
+	case *callExpr:
+		for _, arg := range x.args {
+			collectPaths(arg, paths)
+		}
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.tok
+
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		return &literalExpr{value: tok.num}, nil
+	case tokString:
+		p.next()
+		return &literalExpr{value: tok.text}, nil
+	case tokPath:
+		p.next()
+		return &pathExpr{path: tok.text}, nil
+	case tokIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return &literalExpr{value: true}, nil
+		case "false":
+			return &literalExpr{value: false}, nil
+		case "null":
+			return &literalExpr{value: nil}, nil
+		case "$":
+			return &pathExpr{path: ""}, nil
+		}
+
+		if p.isOp("(") {
+			return p.parseCall(tok)
+		}
+
+		return &pathExpr{path: "/" + tok.text}, nil
+	case tokOp:
+		if tok.text == "(" {
+			p.next()
+			x, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+	}
+
+	return nil, p.errorf(tok.pos, "unexpected %s", tok)
+}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	fn, ok := exprFuncs[name.text]
+	if !ok {
+		return nil, p.errorf(name.pos, "unknown function %s", name.text)
+	}
+
+	p.next() // (
+	args := make([]exprNode, 0)
+	for !p.isOp(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		arg, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next() // )
+
+	if len(args) < fn.min || fn.max >= 0 && len(args) > fn.max {
+		return nil, p.errorf(name.pos, "wrong number of arguments for %s", name.text)
+	}
+
+	if name.text == "matches" {
+		//正则表达式缓存在表达式中, 常量模式在编译时检查
+		if lit, ok := args[1].(*literalExpr); ok {
+			if _, err := p.regexps.compile(exprString(lit.value)); err != nil {
+				return nil, p.errorf(name.pos, "invalid pattern for matches: %v", err)
+			}
+		}
+		fn.call = p.regexps.matches
+	}
+
+	return &callExpr{col: p.col(name.pos), name: name.text, fn: fn, args: args}, nil
+}
+
+//
+// 求值
+//
+
+type exprNode interface {
+	eval(root Node) (interface{}, error)
+}
+
+type literalExpr struct {
+	value interface{}
+}
+
+func (x *literalExpr) eval(root Node) (interface{}, error) {
+	return x.value, nil
+}
+
+type pathExpr struct {
+	path string
+}
+
+func (x *pathExpr) eval(root Node) (interface{}, error) {
+	node, err := Holder(root).get(x.path)
+	if err != nil {
+		return nil, nil
+	}
+
+	return node, nil
+}
+
+type memberExpr struct {
+	col int //列号(按字符计, 从0开始)
+	x   exprNode
+	key exprNode
+}
+
+func (x *memberExpr) eval(root Node) (interface{}, error) {
+	v, err := x.x.eval(root)
+	if err != nil || v == nil {
+		return nil, err
+	}
+
+	key, err := x.key.eval(root)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n := v.(type) {
+	case MapNode:
+		if s, ok := key.(string); ok {
+			return n[s], nil
+		}
+	case ArryNode, ArryMapNode:
+		items, _ := asArry(n)
+		f, err := toFloat(key)
+		if err == nil && key != nil {
+			idx := int(f)
+			if idx < 0 {
+				idx += len(items)
+			}
+			if idx >= 0 && idx < len(items) {
+				return items[idx], nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+type unaryExpr struct {
+	col int //列号(按字符计, 从0开始)
+	op  string
+	x   exprNode
+}
+
+func (x *unaryExpr) eval(root Node) (interface{}, error) {
+	v, err := x.x.eval(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if x.op == "!" {
+		return !truthy(v), nil
+	}
+
+	if v == nil {
+		return nil, nil
+	}
+
+	f, err := toFloat(v)
+	if err != nil {
+		return nil, fmt.Errorf("operator - at column %d: %v is not a number", x.col+1, v)
+	}
+
+	return -f, nil
+}
+
+type binaryExpr struct {
+	col  int //列号(按字符计, 从0开始)
+	op   string
+	l, r exprNode
+}
+
+func (x *binaryExpr) eval(root Node) (interface{}, error) {
+	l, err := x.l.eval(root)
+	if err != nil {
+		return nil, err
+	}
+
+	//短路求值
+	switch x.op {
+	case "&&":
+		if !truthy(l) {
+			return false, nil
+		}
+		r, err := x.r.eval(root)
+		return truthy(r), err
+	case "||":
+		if truthy(l) {
+			return true, nil
+		}
+		r, err := x.r.eval(root)
+		return truthy(r), err
+	}
+
+	r, err := x.r.eval(root)
+	if err != nil {
+		return nil, err
+	}
+
+	switch x.op {
+	case "==":
+		return exprEqual(l, r), nil
+	case "!=":
+		return !exprEqual(l, r), nil
+	case "<", "<=", ">", ">=":
+		if l == nil || r == nil {
+			return false, nil
+		}
+		c, err := exprCompare(l, r)
+		if err != nil {
+			return nil, fmt.Errorf("operator %s at column %d: %v", x.op, x.col+1, err)
+		}
+		switch x.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	}
+
+	//算术运算
+	if l == nil || r == nil {
+		return nil, nil
+	}
+
+	if x.op == "+" {
+		_, ls := l.(string)
+		_, rs := r.(string)
+		if ls || rs {
+			return exprString(l) + exprString(r), nil
+		}
+	}
+
+	lf, err := exprNumber(l)
+	if err != nil {
+		return nil, fmt.Errorf("operator %s at column %d: %v", x.op, x.col+1, err)
+	}
+	rf, err := exprNumber(r)
+	if err != nil {
+		return nil, fmt.Errorf("operator %s at column %d: %v", x.op, x.col+1, err)
+	}
+
+	switch x.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, fmt.Errorf("operator / at column %d: division by zero", x.col+1)
+		}
+		return lf / rf, nil
+	}
+
+	if rf == 0 {
+		return nil, fmt.Errorf("operator %% at column %d: division by zero", x.col+1)
+	}
+	return math.Mod(lf, rf), nil
+}
+
+type condExpr struct {
+	col  int //列号(按字符计, 从0开始)
+	cond exprNode
+	a, b exprNode
+}
+
+func (x *condExpr) eval(root Node) (interface{}, error) {
+	c, err := x.cond.eval(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if truthy(c) {
+		return x.a.eval(root)
+	}
+
+	return x.b.eval(root)
+}
+
+type callExpr struct {
+	col  int //列号(按字符计, 从0开始)
+	name string
+	fn   exprFunc
+	args []exprNode
+}
+
+func (x *callExpr) eval(root Node) (interface{}, error) {
+	args := make([]interface{}, len(x.args))
+	for i, arg := range x.args {
+		v, err := arg.eval(root)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+
+		//coalesce 找到非null 值后不再计算后面的参数
+		if x.name == "coalesce" && v != nil {
+			return v, nil
+		}
+	}
+
+	v, err := x.fn.call(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s() at column %d: %v", x.name, x.col+1, err)
+	}
+
+	return v, nil
+}
+
+// 真值: null/false/0/""/空数组/空对象 为false
+func truthy(v interface{}) bool {
+	switch n := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return n
+	case string:
+		return n != ""
+	case MapNode:
+		return len(n) > 0
+	case ArryNode:
+		return len(n) > 0
+	case ArryMapNode:
+		return len(n) > 0
+	}
+
+	if f, err := toFloat(v); err == nil {
+		return f != 0
+	}
+
+	return true
+}
+
+// 数字(字符串不自动转换)
+func exprNumber(v interface{}) (float64, error) {
+	switch v.(type) {
+	case string, bool:
+		return 0, fmt.Errorf("%s is not a number", exprString(v))
+	}
+
+	f, err := toFloat(v)
+	if err != nil {
+		return 0, fmt.Errorf("%v is not a number", exprString(v))
+	}
+
+	return f, nil
+}
+
+// 转换为字符串: 字符串直接返回, 其它为JSON
+func exprString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+
+	s, err := FormatJson(v, "")
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return s
+}
+
+func exprEqual(l, r interface{}) bool {
+	if nodeRank(l) == 2 && nodeRank(r) == 2 {
+		return CompareNode(l, r) == 0
+	}
+
+	if nodeRank(l) != nodeRank(r) {
+		return false
+	}
+
+	if nodeRank(l) == 4 {
+		return CompareNode(l, r) == 0
+	}
+
+	return reflect.DeepEqual(l, r)
+}
+
+func exprCompare(l, r interface{}) (int, error) {
+	rl, rr := nodeRank(l), nodeRank(r)
+	if rl != rr || rl != 2 && rl != 3 {
+		return 0, fmt.Errorf("can not compare %s with %s", exprString(l), exprString(r))
+	}
+
+	return CompareNode(l, r), nil
+}
+
+//
+// 函数
+//
+
+type exprFunc struct {
+	min, max int //参数个数, max<0 时不限
+	call     func(args []interface{}) (interface{}, error)
+}
+
+var exprFuncs = map[string]exprFunc{
+	"len":        {1, 1, fnLen},
+	"coalesce":   {1, -1, fnCoalesce},
+	"upper":      {1, 1, strFunc(strings.ToUpper)},
+	"lower":      {1, 1, strFunc(strings.ToLower)},
+	"trim":       {1, 1, strFunc(strings.TrimSpace)},
+	"contains":   {2, 2, fnContains},
+	"startsWith": {2, 2, str2Func(strings.HasPrefix)},
+	"endsWith":   {2, 2, str2Func(strings.HasSuffix)},
+	"substr":     {2, 3, fnSubstr},
+	"replace":    {3, 3, fnReplace},
+	"split":      {2, 2, fnSplit},
+	"join":       {2, 2, fnJoin},
+	"concat":     {0, -1, fnConcat},
+	"matches":    {2, 2, nil}, //编译时绑定表达式的正则缓存, 见parseCall
+	"str":        {1, 1, fnStr},
+	"num":        {1, 1, fnNum},
+	"int":        {1, 1, fnInt},
+	"abs":        {1, 1, numFunc(math.Abs)},
+	"floor":      {1, 1, numFunc(math.Floor)},
+	"ceil":       {1, 1, numFunc(math.Ceil)},
+	"round":      {1, 2, fnRound},
+	"min":        {1, -1, fnMin},
+	"max":        {1, -1, fnMax},
+}
+
+func fnLen(args []interface{}) (interface{}, error) {
+	switch n := args[0].(type) {
+	case nil:
+		return 0.0, nil
+	case string:
+		return float64(utf8.RuneCountInString(n)), nil
+	case MapNode:
+		return float64(len(n)), nil
+	case ArryNode:
+		return float64(len(n)), nil
+	case ArryMapNode:
+		return float64(len(n)), nil
+	}
+
+	return nil, fmt.Errorf("%s has no length", exprString(args[0]))
+}
+
+func fnCoalesce(args []interface{}) (interface{}, error) {
+	for _, arg := range args {
+		if arg != nil {
+			return arg, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// 字符串函数: 参数为null 时返回null
+func strFunc(fn func(string) string) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+
+		return fn(exprString(args[0])), nil
+	}
+}
+
+func str2Func(fn func(string, string) bool) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if args[0] == nil || args[1] == nil {
+			return false, nil
+		}
+
+		return fn(exprString(args[0]), exprString(args[1])), nil
+	}
+}
+
+func numFunc(fn func(float64) float64) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+
+		f, err := exprNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return fn(f), nil
+	}
+}
+
+// 字符串包含子串, 或数组包含元素
+func fnContains(args []interface{}) (interface{}, error) {
+	if items, ok := asArry(args[0]); ok {
+		for _, item := range items {
+			if exprEqual(item, args[1]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if args[0] == nil || args[1] == nil {
+		return false, nil
+	}
+
+	return strings.Contains(exprString(args[0]), exprString(args[1])), nil
+}
+
+// substr(s, start[, length]), 按字符计算
+func fnSubstr(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	runes := []rune(exprString(args[0]))
+	start, err := exprNumber(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	begin := int(start)
+	if begin < 0 {
+		begin += len(runes)
+	}
+	if begin < 0 {
+		begin = 0
+	}
+	if begin > len(runes) {
+		begin = len(runes)
+	}
+
+	end := len(runes)
+	if len(args) > 2 {
+		length, err := exprNumber(args[2])
+		if err != nil {
+			return nil, err
+		}
+		if begin+int(length) < end {
+			end = begin + int(length)
+		}
+		if end < begin {
+			end = begin
+		}
+	}
+
+	return string(runes[begin:end]), nil
+}
+
+func fnReplace(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	return strings.ReplaceAll(exprString(args[0]), exprString(args[1]), exprString(args[2])), nil
+}
+
+func fnSplit(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	parts := strings.Split(exprString(args[0]), exprString(args[1]))
+	items := make(ArryNode, len(parts))
+	for i, part := range parts {
+		items[i] = part
+	}
+
+	return items, nil
+}
+
+func fnJoin(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	items, ok := asArry(args[0])
+	if !ok {
+		return nil, fmt.Errorf("%s is not an array", exprString(args[0]))
+	}
+
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = exprString(item)
+	}
+
+	return strings.Join(parts, exprString(args[1])), nil
+}
+
+// 拼接字符串, null 作为空字符串
+func fnConcat(args []interface{}) (interface{}, error) {
+	buff := strings.Builder{}
+	for _, arg := range args {
+		if arg != nil {
+			buff.WriteString(exprString(arg))
+		}
+	}
+
+	return buff.String(), nil
+}
+
+// matches() 的正则表达式缓存: 每个编译后的表达式一个, 可以在多个goroutine 中同时计算
+type exprRegexps struct {
+	mu sync.Mutex
+	m  map[string]*regexp.Regexp
+}
+
+// 缓存的正则表达式个数上限, 模式来自数据时不会无限增长
+const maxExprRegexps = 64
+
+func (c *exprRegexps) compile(pattern string) (*regexp.Regexp, error) {
+	c.mu.Lock()
+	re, ok := c.m[pattern]
+	c.mu.Unlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if len(c.m) < maxExprRegexps {
+		c.m[pattern] = re
+	}
+	c.mu.Unlock()
+
+	return re, nil
+}
+
+func (c *exprRegexps) matches(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return false, nil
+	}
+
+	re, err := c.compile(exprString(args[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	return re.MatchString(exprString(args[0])), nil
+}
+
+func fnStr(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	return exprString(args[0]), nil
+}
+
+// 转换为数字(字符串按数字解析, 转换规则同GetFloat)
+func fnNum(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	if b, ok := args[0].(bool); ok {
+		if b {
+			return 1.0, nil
+		}
+		return 0.0, nil
+	}
+
+	f, err := toFloat(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("can not convert %s to number", exprString(args[0]))
+	}
+
+	return f, nil
+}
+
+func fnInt(args []interface{}) (interface{}, error) {
+	v, err := fnNum(args)
+	if err != nil || v == nil {
+		return v, err
+	}
+
+	return math.Trunc(v.(float64)), nil
+}
+
+// round(x[, 小数位数])
+func fnRound(args []interface{}) (interface{}, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	f, err := exprNumber(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	digits := 0.0
+	if len(args) > 1 {
+		digits, err = exprNumber(args[1])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	scale := math.Pow(10, math.Trunc(digits))
+	return math.Round(f*scale) / scale, nil
+}
+
+// 最小值: 参数可以是数字或数字数组, 忽略null
+func fnMin(args []interface{}) (interface{}, error) {
+	return fnExtreme(args, -1)
+}
+
+func fnMax(args []interface{}) (interface{}, error) {
+	return fnExtreme(args, 1)
+}
+
+func fnExtreme(args []interface{}, sign int) (interface{}, error) {
+	var result interface{}
+
+	values := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		if items, ok := asArry(arg); ok {
+			values = append(values, items...)
+		} else {
+			values = append(values, arg)
+		}
+	}
+
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+
+		f, err := exprNumber(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if result == nil || sign < 0 && f < result.(float64) || sign > 0 && f > result.(float64) {
+			result = f
+		}
+	}
+
+	return result, nil
+}
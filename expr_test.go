@@ -0,0 +1,155 @@
+package jsnx
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExprEval(t *testing.T) {
+	holder, err := NewJsonHolder(`{
+		"user": {"name": "Alice", "age": 30, "tags": ["a", "b"], "email": null},
+		"items": [{"price": 2, "qty": 3}, {"price": 5, "qty": 1}],
+		"n": 7,
+		"s": "héllo"
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{"user.age + 1", 31.0},
+		{"/user/age * 2", 60.0},
+		{"user.tags[1]", "b"},
+		{"user.tags[-1]", "b"},
+		{"items[0].price * items[0].qty", 6.0},
+		{"user.missing", nil},
+		{"user.missing?.x", nil},
+		{"user.missing + 1", nil},
+		{`"n=" + n`, "n=7"},
+		{"n % 4", 3.0},
+		{"-n", -7.0},
+		{"n > 5 && user.name == 'Alice'", true},
+		{"n < 5 || !user.email", true},
+		{"n >= 7 ? 'big' : 'small'", "big"},
+		{"user.missing < 1", false},
+		{"len(s)", 5.0},
+		{"len(user.tags)", 2.0},
+		{"coalesce(user.email, user.missing, 'none')", "none"},
+		{"upper(user.name)", "ALICE"},
+		{"contains(user.tags, 'b')", true},
+		{"contains(user.name, 'lic')", true},
+		{"startsWith(user.name, 'Al')", true},
+		{"substr(s, 1, 3)", "éll"},
+		{"replace(user.name, 'A', 'a')", "alice"},
+		{"split('a,b', ',')", ArryNode{"a", "b"}},
+		{"join(user.tags, '-')", "a-b"},
+		{"concat(user.name, n)", "Alice7"},
+		{"matches(user.name, '^A.*e$')", true},
+		{"num('1.5') + int(2.7)", 3.5},
+		{"round(2.345, 2)", 2.35},
+		{"min(3, n, 1)", 1.0},
+		{"max(items[0].price, items[1].price)", 5.0},
+		{"abs(-2) + floor(1.5) + ceil(1.5)", 5.0},
+		{"$.n", 7.0},
+		{"str(user.tags)", `["a","b"]`},
+		{"user == user", true},
+		{"1 == 1.0", true},
+		{"'1' == 1", false},
+	}
+
+	for _, tt := range tests {
+		got, err := holder.Eval(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		msg  string //错误信息中包含的内容
+	}{
+		{"1 +", "at column 4"},
+		{"(1", "at column 3"},
+		{"nope(1)", "unknown function nope"},
+		{"len(1, 2)", "wrong number of arguments"},
+		{"matches('a', '(')", "invalid pattern"},
+		{"'é' + ", "at column 7"},
+	}
+	for _, tt := range tests {
+		_, err := CompileExpr(tt.expr)
+		var exprErr *ExprError
+		if !errors.As(err, &exprErr) || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("CompileExpr(%q) error %v, want %q", tt.expr, err, tt.msg)
+		}
+	}
+
+	//运行时错误报告运算符所在列
+	holder, _ := NewJsonHolder(`{"s":"x","n":0}`)
+	for expr, msg := range map[string]string{
+		"s * 2":               "operator * at column 3",
+		"1 / n":               "division by zero",
+		"s < 1":               "can not compare",
+		"matches(s, s + '(')": "matches() at column 1",
+	} {
+		if _, err := holder.Eval(expr); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("Eval(%q) error %v, want %q", expr, err, msg)
+		}
+	}
+}
+
+func TestExprPaths(t *testing.T) {
+	e := MustCompileExpr("a.b + /c/0 + len(d[e]) + $.f")
+	if want := []string{"/a/b", "/c/0", "/d", "/e", "/f"}; !reflect.DeepEqual(e.Paths(), want) {
+		t.Errorf("Paths() = %v, want %v", e.Paths(), want)
+	}
+	if e.String() != "a.b + /c/0 + len(d[e]) + $.f" {
+		t.Errorf("String() = %q", e.String())
+	}
+}
+
+func TestFilterExpr(t *testing.T) {
+	holder, _ := NewJsonHolder(`{"items":[{"n":1},{"n":5},{"n":3}]}`)
+
+	result, err := holder.FilterExpr("/items", "n > 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := result.String("/", ""); s != `[{"n":5},{"n":3}]` {
+		t.Errorf("filtered %s", s)
+	}
+	if n, _ := holder.ArryLen("/items"); n != 3 {
+		t.Errorf("holder changed without inPlace: len %d", n)
+	}
+
+	if _, err = holder.FilterExpr("/items", "n > 2", true); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := holder.ArryLen("/items"); n != 2 {
+		t.Errorf("inPlace len %d, want 2", n)
+	}
+}
+
+// 表达式出错时不写回: 之前的元素已经计算也不修改holder
+func TestFilterExprError(t *testing.T) {
+	holder, _ := NewJsonHolder(`{"items":[{"n":1},{"n":5},{"n":"x"},{"n":3}]}`)
+	before, _ := holder.String("/", "")
+
+	_, err := holder.FilterExpr("/items", "n * 2 > 4", true)
+	if err == nil || !strings.Contains(err.Error(), "element 2") {
+		t.Errorf("error %v, want element 2", err)
+	}
+	if after, _ := holder.String("/", ""); after != before {
+		t.Errorf("holder changed by failed filter: %s", after)
+	}
+}
@@ -0,0 +1,290 @@
+package jsnx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 扁平化时数组索引的格式
+const (
+	FlatIndex   = 0 //索引作为一级路径: items/0/sku (分隔符为 / 时可直接用于Get/SetJson)
+	FlatBracket = 1 //索引加方括号: items[0].sku
+)
+
+// 将指定结点展开为 {叶子路径: 值}, 路径相对于path;
+// 空对象/空数组作为叶子保留, 保证Unflatten 能还原;
+// 数字键值、含分隔符、双引号或方括号的键值加双引号(内部的 " 及 \ 用 \ 转义)
+func (holder *JsonHolder) Flatten(path, separator string, arrayStyle int) (map[string]interface{}, error) {
+	if separator == "" {
+		return nil, fmt.Errorf("separator is empty")
+	}
+
+	holder.mu.RLock()
+	defer holder.mu.RUnlock()
+
+	node, err := holder.get(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]interface{})
+	flattenNode("", node, separator, arrayStyle, result)
+	return result, nil
+}
+
+func Flatten(data interface{}, path, separator string, arrayStyle int) (map[string]interface{}, error) {
+	jsx := &JsonHolder{Data: data}
+	return jsx.Flatten(path, separator, arrayStyle)
+}
+
+func flattenNode(prefix string, node Node, sep string, style int, result map[string]interface{}) {
+	switch n := node.(type) {
+	case MapNode:
+		if len(n) == 0 {
+			result[prefix] = MapNode{}
+			return
+		}
+		for key, v := range n {
+			seg := flatKey(key, sep, style)
+			if prefix != "" {
+				seg = prefix + sep + seg
+			}
+			flattenNode(seg, v, sep, style, result)
+		}
+	case ArryNode, ArryMapNode:
+		items, _ := asArry(n)
+		if len(items) == 0 {
+			result[prefix] = ArryNode{}
+			return
+		}
+		for i, v := range items {
+			var seg string
+			if style == FlatBracket {
+				seg = prefix + "[" + strconv.Itoa(i) + "]"
+			} else if prefix != "" {
+				seg = prefix + sep + strconv.Itoa(i)
+			} else {
+				seg = strconv.Itoa(i)
+			}
+			flattenNode(seg, v, sep, style, result)
+		}
+	default:
+		result[prefix] = node
+	}
+}
+
+// 对象键值: 需要时加双引号
+func flatKey(key, sep string, style int) string {
+	quote := arryIndex(key) >= 0 || strings.Contains(key, sep) || strings.ContainsAny(key, "\"\\")
+	if style == FlatBracket && strings.ContainsAny(key, "[]") {
+		quote = true
+	}
+
+	if !quote {
+		return key
+	}
+
+	key = strings.ReplaceAll(key, "\\", "\\\\")
+	key = strings.ReplaceAll(key, "\"", "\\\"")
+	return "\"" + key + "\""
+}
+
+// 扁平路径中的一级
+type flatSeg struct {
+	key   string
+	index int //>=0 时为数组索引
+}
+
+// 解析扁平路径
+func parseFlatKey(flatKey, sep string, style int) ([]flatSeg, error) {
+	segs := make([]flatSeg, 0)
+	rest := flatKey
+
+	for rest != "" {
+		var (
+			raw    string
+			quoted bool
+		)
+
+		if strings.HasPrefix(rest, "\"") {
+			//带双引号的键值
+			buff := strings.Builder{}
+			i := 1
+			for ; i < len(rest); i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+					buff.WriteByte(rest[i])
+					continue
+				}
+				if rest[i] == '"' {
+					break
+				}
+				buff.WriteByte(rest[i])
+			}
+			if i >= len(rest) {
+				return nil, fmt.Errorf("key(%v) quote not closed", flatKey)
+			}
+			raw = buff.String()
+			quoted = true
+			rest = rest[i+1:]
+		} else if style == FlatBracket && strings.HasPrefix(rest, "[") {
+			raw = ""
+		} else {
+			end := strings.Index(rest, sep)
+			if style == FlatBracket {
+				if b := strings.Index(rest, "["); b >= 0 && (end < 0 || b < end) {
+					end = b
+				}
+			}
+			if end < 0 {
+				end = len(rest)
+			}
+			raw = rest[:end]
+			rest = rest[end:]
+		}
+
+		if quoted || style == FlatBracket {
+			if quoted || raw != "" {
+				segs = append(segs, flatSeg{key: raw, index: -1})
+			}
+		} else {
+			segs = append(segs, flatSeg{key: raw, index: flatIndex(raw)})
+		}
+
+		//数组索引 [n]
+		for style == FlatBracket && strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("key(%v) bracket not closed", flatKey)
+			}
+			idx, err := strconv.Atoi(rest[1:end])
+			if err != nil || idx < 0 {
+				return nil, fmt.Errorf("key(%v) invalid index", flatKey)
+			}
+			segs = append(segs, flatSeg{index: idx})
+			rest = rest[end+1:]
+		}
+
+		if rest == "" {
+			break
+		}
+		if !strings.HasPrefix(rest, sep) {
+			return nil, fmt.Errorf("key(%v) invalid at %v", flatKey, rest)
+		}
+		rest = rest[len(sep):]
+		if rest == "" {
+			return nil, fmt.Errorf("key(%v) ends with separator", flatKey)
+		}
+	}
+
+	return segs, nil
+}
+
+// 未加引号的数字为数组索引
+func flatIndex(key string) int {
+	idx, err := strconv.Atoi(key)
+	if err != nil || idx < 0 {
+		return -1
+	}
+
+	return idx
+}
+
+// 由Flatten 的结果还原为holder
+func Unflatten(flat map[string]interface{}, separator string, arrayStyle int) (*JsonHolder, error) {
+	var root interface{}
+
+	if separator == "" {
+		return nil, fmt.Errorf("separator is empty")
+	}
+
+	for flatKey, value := range flat {
+		segs, err := parseFlatKey(flatKey, separator, arrayStyle)
+		if err != nil {
+			return nil, err
+		}
+
+		root, err = unflattenNode(root, segs, copyEmpty(value), flatKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return Holder(root), nil
+}
+
+// 空容器复制一份, 避免与输入共享
+func copyEmpty(value interface{}) interface{} {
+	switch n := value.(type) {
+	case MapNode:
+		if len(n) == 0 {
+			return MapNode{}
+		}
+	case ArryNode:
+		if len(n) == 0 {
+			return ArryNode{}
+		}
+	}
+
+	return value
+}
+
+func unflattenNode(node interface{}, segs []flatSeg, value interface{}, flatKey string) (interface{}, error) {
+	if len(segs) == 0 {
+		if node == nil || isEmptyContainer(node) {
+			return value, nil
+		}
+		if isEmptyContainer(value) {
+			return node, nil
+		}
+		return nil, fmt.Errorf("key(%v) conflicts with other keys", flatKey)
+	}
+
+	seg := segs[0]
+	if seg.index >= 0 {
+		if node == nil {
+			node = ArryNode{}
+		}
+		arryNode, ok := node.(ArryNode)
+		if !ok {
+			return nil, fmt.Errorf("key(%v) conflicts with other keys", flatKey)
+		}
+		for len(arryNode) <= seg.index {
+			arryNode = append(arryNode, nil)
+		}
+
+		child, err := unflattenNode(arryNode[seg.index], segs[1:], value, flatKey)
+		if err != nil {
+			return nil, err
+		}
+		arryNode[seg.index] = child
+		return arryNode, nil
+	}
+
+	if node == nil {
+		node = MapNode{}
+	}
+	mapNode, ok := node.(MapNode)
+	if !ok {
+		return nil, fmt.Errorf("key(%v) conflicts with other keys", flatKey)
+	}
+
+	child, err := unflattenNode(mapNode[seg.key], segs[1:], value, flatKey)
+	if err != nil {
+		return nil, err
+	}
+	mapNode[seg.key] = child
+	return mapNode, nil
+}
+
+func isEmptyContainer(node interface{}) bool {
+	switch n := node.(type) {
+	case MapNode:
+		return len(n) == 0
+	case ArryNode:
+		return len(n) == 0
+	}
+
+	return false
+}
@@ -0,0 +1,112 @@
+package jsnx
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Flatten 后Unflatten 还原为相同的数据
+func checkRoundTrip(t *testing.T, doc, sep string, style int) map[string]interface{} {
+	t.Helper()
+
+	holder, err := NewJsonHolder(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flat, err := holder.Flatten("/", sep, style)
+	if err != nil {
+		t.Fatalf("Flatten(%s): %v", doc, err)
+	}
+
+	restored, err := Unflatten(flat, sep, style)
+	if err != nil {
+		t.Fatalf("Unflatten(%v): %v", flat, err)
+	}
+	if !reflect.DeepEqual(restored.Data, holder.Data) {
+		got, _ := restored.String("/", "")
+		t.Errorf("sep %q style %d: %s restored as %s (flat %v)", sep, style, doc, got, flat)
+	}
+
+	return flat
+}
+
+func TestFlattenRoundTrip(t *testing.T) {
+	docs := []string{
+		`{"a":{"b":1,"c":[1,{"d":"x"}]}}`,
+		`{"0":{"1":"numeric keys"},"list":[["a"],["b",null]]}`,
+		`{"e":{},"f":[],"g":[{},[]],"h":{"i":{}}}`,
+		`{"a/b":1,"a.b":2,"a":{"b":3},"q\"uote":4,"back\\slash":5}`,
+		`{"x[0]":1,"y]":2,"[":{"z":[3]}}`,
+		`{"":1,"n":{"":{"":2}}}`,
+		`[1,{"a":[]},[[2]]]`,
+		`{}`,
+		`[]`,
+		`"scalar"`,
+		`{"null":null,"t":true,"n":-1.5}`,
+	}
+
+	for _, doc := range docs {
+		for _, sep := range []string{"/", ".", "::"} {
+			checkRoundTrip(t, doc, sep, FlatIndex)
+			checkRoundTrip(t, doc, sep, FlatBracket)
+		}
+	}
+}
+
+func TestFlattenKeys(t *testing.T) {
+	tests := []struct {
+		doc, sep string
+		style    int
+		want     map[string]interface{}
+	}{
+		{`{"a":{"b":1},"c":[2,3]}`, "/", FlatIndex,
+			map[string]interface{}{"a/b": 1.0, "c/0": 2.0, "c/1": 3.0}},
+		{`{"a":{"b":1},"c":[2,[3]]}`, ".", FlatBracket,
+			map[string]interface{}{"a.b": 1.0, "c[0]": 2.0, "c[1][0]": 3.0}},
+		//数字键值加引号, 与数组索引区分
+		{`{"0":{"1":true},"l":[true]}`, "/", FlatIndex,
+			map[string]interface{}{`"0"/"1"`: true, "l/0": true}},
+		//含分隔符的键值加引号
+		{`{"a.b":{"c":1}}`, ".", FlatIndex,
+			map[string]interface{}{`"a.b".c`: 1.0}},
+		{`{"a::b":1,"a:b":2}`, "::", FlatIndex,
+			map[string]interface{}{`"a::b"`: 1.0, "a:b": 2.0}},
+		//方括号格式下含方括号的键值加引号
+		{`{"x[0]":1}`, ".", FlatBracket,
+			map[string]interface{}{`"x[0]"`: 1.0}},
+		{`{"e":{},"f":[]}`, "/", FlatIndex,
+			map[string]interface{}{"e": MapNode{}, "f": ArryNode{}}},
+	}
+
+	for _, tt := range tests {
+		flat := checkRoundTrip(t, tt.doc, tt.sep, tt.style)
+		if !reflect.DeepEqual(flat, tt.want) {
+			t.Errorf("Flatten(%s, %q) = %v, want %v", tt.doc, tt.sep, flat, tt.want)
+		}
+	}
+}
+
+func TestUnflattenErrors(t *testing.T) {
+	tests := []struct {
+		flat  map[string]interface{}
+		style int
+	}{
+		{map[string]interface{}{"a": 1, "a/b": 2}, FlatIndex},
+		{map[string]interface{}{"a/0": 1, "a/b": 2}, FlatIndex},
+		{map[string]interface{}{`"a`: 1}, FlatIndex},
+		{map[string]interface{}{"a/": 1}, FlatIndex},
+		{map[string]interface{}{"a[x]": 1}, FlatBracket},
+		{map[string]interface{}{"a[0": 1}, FlatBracket},
+	}
+
+	for _, tt := range tests {
+		if _, err := Unflatten(tt.flat, "/", tt.style); err == nil {
+			t.Errorf("Unflatten(%v) accepted", tt.flat)
+		}
+	}
+
+	if _, err := Unflatten(map[string]interface{}{"a": 1}, "", FlatIndex); err == nil {
+		t.Error("empty separator accepted")
+	}
+}
@@ -0,0 +1,232 @@
+package jsnx
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 字段名中按全大写输出的缩写
+var goInitialisms = map[string]bool{
+	"API": true, "HTML": true, "HTTP": true, "HTTPS": true, "ID": true, "IP": true, "JSON": true,
+	"SQL": true, "URI": true, "URL": true, "UUID": true, "XML": true,
+}
+
+// 由JSON Schema(如InferSchema 的结果) 生成Go 结构体定义:
+// 对象生成嵌套的结构体类型, 数组为切片, 可为null 的字段为指针, 非必填字段加omitempty;
+// pkg 不为空时输出package 语句
+func GenerateStructs(schema *JsonHolder, typeName, pkg string) ([]byte, error) {
+	schema.mu.RLock()
+	root := schema.Data
+	schema.mu.RUnlock()
+
+	g := &structGen{names: make(map[string]bool), imports: make(map[string]bool)}
+	if _, err := g.goType(root, goName(typeName), true); err != nil {
+		return nil, err
+	}
+
+	buff := bytes.Buffer{}
+	if pkg != "" {
+		fmt.Fprintf(&buff, "package %s\n\n", pkg)
+	}
+	if len(g.imports) > 0 {
+		imports := make([]string, 0, len(g.imports))
+		for imp := range g.imports {
+			imports = append(imports, strconv.Quote(imp))
+		}
+		sort.Strings(imports)
+		fmt.Fprintf(&buff, "import (\n%s\n)\n\n", strings.Join(imports, "\n"))
+	}
+	for _, decl := range g.decls {
+		buff.WriteString(decl)
+		buff.WriteString("\n")
+	}
+
+	src, err := format.Source(buff.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("gostruct: %v", err)
+	}
+
+	return src, nil
+}
+
+// 由holder 中的数据推断结构并生成Go 结构体定义
+func (holder *JsonHolder) GenerateStructs(typeName, pkg string) ([]byte, error) {
+	return GenerateStructs(InferSchema(holder), typeName, pkg)
+}
+
+type structGen struct {
+	names   map[string]bool //已使用的类型名
+	decls   []string
+	imports map[string]bool
+}
+
+// schema 对应的Go 类型, 对象生成名为name 的结构体
+func (g *structGen) goType(schema Node, name string, required bool) (string, error) {
+	sch, ok := schema.(MapNode)
+	if !ok {
+		return "interface{}", nil
+	}
+
+	types := make([]string, 0)
+	nullable := false
+	switch t := sch["type"].(type) {
+	case string:
+		types = append(types, t)
+	case ArryNode:
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+	}
+	for i := 0; i < len(types); i++ {
+		if types[i] == "null" {
+			nullable = true
+			types = append(types[:i], types[i+1:]...)
+			i--
+		}
+	}
+
+	if len(types) != 1 {
+		return "interface{}", nil //没有类型或多种类型
+	}
+
+	var goType string
+	switch types[0] {
+	case "boolean":
+		goType = "bool"
+	case "integer":
+		goType = "int64"
+	case "number":
+		goType = "float64"
+	case "string":
+		goType = "string"
+		if sch["format"] == "date-time" {
+			goType = "time.Time"
+			g.imports["time"] = true
+		}
+	case "array":
+		elem, err := g.goType(sch["items"], name+"Item", true)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + elem, nil //切片本身可以为nil
+	case "object":
+		structName, err := g.genStruct(sch, name)
+		if err != nil {
+			return "", err
+		}
+		goType = structName
+	default:
+		return "", fmt.Errorf("gostruct: unknown type(%v)", types[0])
+	}
+
+	//map 本身可以为nil
+	if (nullable || (!required && types[0] == "object")) && !strings.HasPrefix(goType, "map[") {
+		goType = "*" + goType
+	}
+
+	return goType, nil
+}
+
+// 生成结构体定义, 返回类型名
+func (g *structGen) genStruct(sch MapNode, name string) (string, error) {
+	typeName := name
+	for i := 2; g.names[typeName]; i++ {
+		typeName = name + strconv.Itoa(i)
+	}
+	g.names[typeName] = true
+
+	properties, _ := sch["properties"].(MapNode)
+	if len(properties) == 0 {
+		//没有属性时按map 处理
+		delete(g.names, typeName)
+		return "map[string]interface{}", nil
+	}
+
+	required := make(map[string]bool)
+	if items, ok := asArry(sch["required"]); ok {
+		for _, item := range items {
+			if key, ok := item.(string); ok {
+				required[key] = true
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	//先占位, 嵌套类型的定义放在后面
+	idx := len(g.decls)
+	g.decls = append(g.decls, "")
+
+	fields := make(map[string]bool)
+	buff := strings.Builder{}
+	fmt.Fprintf(&buff, "type %s struct {\n", typeName)
+	for _, key := range keys {
+		field := goName(key)
+		for i := 2; fields[field]; i++ {
+			field = goName(key) + strconv.Itoa(i)
+		}
+		fields[field] = true
+
+		fieldType, err := g.goType(properties[key], typeName+field, required[key])
+		if err != nil {
+			return "", err
+		}
+
+		tag := key
+		if !required[key] {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(&buff, "\t%s %s `json:%s`\n", field, fieldType, strconv.Quote(tag))
+	}
+	buff.WriteString("}\n")
+
+	g.decls[idx] = buff.String()
+	return typeName, nil
+}
+
+// JSON 键值转换为导出的Go 标识符
+func goName(key string) string {
+	words := strings.FieldsFunc(key, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	buff := strings.Builder{}
+	for _, word := range words {
+		//camelCase 按大写字母拆分
+		start := 0
+		runes := []rune(word)
+		for i := 1; i <= len(runes); i++ {
+			if i == len(runes) || (unicode.IsUpper(runes[i]) && !unicode.IsUpper(runes[i-1])) {
+				part := string(runes[start:i])
+				if upper := strings.ToUpper(part); goInitialisms[upper] {
+					buff.WriteString(upper)
+				} else {
+					r := []rune(part)
+					buff.WriteString(string(unicode.ToUpper(r[0])) + string(r[1:]))
+				}
+				start = i
+			}
+		}
+	}
+
+	name := buff.String()
+	if name == "" {
+		return "Field"
+	}
+	if unicode.IsDigit([]rune(name)[0]) {
+		name = "F" + name
+	}
+
+	return name
+}
@@ -0,0 +1,94 @@
+package jsnx
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateStructs(t *testing.T) {
+	schema, err := NewJsonHolder(`{
+		"type": "object",
+		"required": ["id", "user_name", "created", "items"],
+		"properties": {
+			"id": {"type": "integer"},
+			"user_name": {"type": "string"},
+			"apiURL": {"type": "string"},
+			"created": {"type": "string", "format": "date-time"},
+			"score": {"type": ["number", "null"]},
+			"mixed": {"type": ["string", "integer"]},
+			"items": {"type": "array", "items": {"type": "object", "required": ["sku"], "properties": {"sku": {"type": "string"}, "qty": {"type": "integer"}}}},
+			"owner": {"type": "object", "properties": {"id": {"type": "integer"}}},
+			"extra": {"type": "object"},
+			"2fa": {"type": "boolean"},
+			"user-name": {"type": "string"}
+		}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := GenerateStructs(schema, "order", "model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+
+	for _, want := range []string{
+		"package model\n",
+		"import (\n\t\"time\"\n)",
+		"type Order struct {",
+		"ID int64 `json:\"id\"`",
+		"UserName string `json:\"user-name,omitempty\"`",
+		"UserName2 string `json:\"user_name\"`",
+		"APIURL string `json:\"apiURL,omitempty\"`",
+		"Created time.Time `json:\"created\"`",
+		"Score *float64 `json:\"score,omitempty\"`",
+		"Mixed interface{} `json:\"mixed,omitempty\"`",
+		"Items []OrderItemsItem `json:\"items\"`",
+		"Owner *OrderOwner `json:\"owner,omitempty\"`",
+		"Extra map[string]interface{} `json:\"extra,omitempty\"`",
+		"F2fa bool `json:\"2fa,omitempty\"`",
+		"type OrderItemsItem struct {",
+		"Sku string `json:\"sku\"`",
+		"Qty int64 `json:\"qty,omitempty\"`",
+		"type OrderOwner struct {",
+	} {
+		if !strings.Contains(strings.Join(strings.Fields(code), " "), strings.Join(strings.Fields(want), " ")) {
+			t.Errorf("generated code missing %q:\n%s", want, code)
+		}
+	}
+
+	//嵌套类型的定义在外层类型之后
+	if strings.Index(code, "type Order struct") > strings.Index(code, "type OrderOwner struct") {
+		t.Errorf("nested type declared before outer type:\n%s", code)
+	}
+}
+
+func TestGenerateStructsFromData(t *testing.T) {
+	holder, _ := NewJsonHolder(`{"name":"a","tags":["x"],"point":{"x":1,"y":2.5}}`)
+
+	src, err := holder.GenerateStructs("Doc", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := strings.Join(strings.Fields(string(src)), " ")
+	if strings.Contains(code, "package") {
+		t.Errorf("package clause generated without pkg:\n%s", src)
+	}
+	for _, want := range []string{
+		"Name string `json:\"name\"`",
+		"Tags []string `json:\"tags\"`",
+		"Point DocPoint `json:\"point\"`",
+		"X int64 `json:\"x\"`",
+		"Y float64 `json:\"y\"`",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code missing %q:\n%s", want, src)
+		}
+	}
+
+	if _, err = GenerateStructs(Holder(MapNode{"type": "tuple"}), "T", ""); err == nil {
+		t.Error("unknown type accepted")
+	}
+}
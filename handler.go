@@ -0,0 +1,330 @@
+package jsnx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 以REST 方式提供holder 中的数据, URL 路径(去掉Prefix)即结点路径:
+//
+//	GET/HEAD  读取结点, 支持If-None-Match
+//	PUT       写入结点(不存在时创建)
+//	POST      向数组追加元素, Location 为新元素的路径
+//	PATCH     application/json-patch+json 为JSON Patch, 其它为Merge Patch
+//	DELETE    删除结点
+//
+// 响应的ETag 为结点内容的哈希, 写操作可以用If-Match 做并发控制
+type Handler struct {
+	Holder   *JsonHolder
+	Prefix   string //URL 前缀, 如 /config
+	ReadOnly bool   //只读时写操作返回405
+	MaxBody  int64  //请求体最大字节数, 0 为不限制
+}
+
+// 创建Handler
+func NewHandler(holder *JsonHolder, prefix string, readOnly ...bool) *Handler {
+	return &Handler{Holder: holder, Prefix: strings.TrimSuffix(prefix, "/"), ReadOnly: len(readOnly) > 0 && readOnly[0]}
+}
+
+// 带状态码的错误
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func httpErrorf(status int, format string, args ...interface{}) error {
+	return &httpError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// 结点的ETag
+func (holder *JsonHolder) ETag(path string) (string, error) {
+	holder.mu.RLock()
+	defer holder.mu.RUnlock()
+
+	node, exist := holder.lookup(path)
+	if !exist {
+		return "", fmt.Errorf("Path(%v) not found", cleanPath(path))
+	}
+
+	return nodeETag(node), nil
+}
+
+func nodeETag(node Node) string {
+	str, err := FormatJson(node, "")
+	if err != nil {
+		str = fmt.Sprint(node)
+	}
+
+	return jsonETag(str)
+}
+
+func jsonETag(str string) string {
+	sum := sha256.Sum256([]byte(str))
+	return "\"" + hex.EncodeToString(sum[:16]) + "\""
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, h.Prefix)
+	if !strings.HasPrefix(r.URL.Path, h.Prefix) || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		http.NotFound(w, r)
+		return
+	}
+	path := cleanPath(rest)
+
+	var err error
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		err = h.get(w, r, path)
+	case http.MethodPut, http.MethodPost, http.MethodPatch, http.MethodDelete:
+		if h.ReadOnly {
+			w.Header().Set("Allow", "GET, HEAD")
+			err = httpErrorf(http.StatusMethodNotAllowed, "read-only")
+		} else {
+			err = h.write(w, r, path)
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST, PATCH, DELETE")
+		err = httpErrorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+	}
+
+	if err != nil {
+		status := http.StatusBadRequest
+		var httpErr *httpError
+		if errors.As(err, &httpErr) {
+			status = httpErr.status
+		}
+		h.reply(w, r, status, MapNode{"error": err.Error()}, "")
+	}
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, path string) error {
+	str, etag, exist, err := h.lookupJson(path)
+	if !exist {
+		return httpErrorf(http.StatusNotFound, "Path(%v) not found", path)
+	}
+	if err != nil {
+		return httpErrorf(http.StatusInternalServerError, "%v", err)
+	}
+
+	if matchETag(r.Header.Get("If-None-Match"), etag, true) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	h.replyJson(w, r, http.StatusOK, str, etag)
+	return nil
+}
+
+// 在读锁内序列化结点(写入时可能原位置修改结点, 不能在释放锁后序列化), 返回JSON 及ETag
+func (h *Handler) lookupJson(path string) (string, string, bool, error) {
+	h.Holder.mu.RLock()
+	defer h.Holder.mu.RUnlock()
+
+	node, exist := h.Holder.lookup(path)
+	if !exist {
+		return "", "", false, nil
+	}
+
+	str, err := FormatJson(node, "")
+	if err != nil {
+		return "", "", true, err
+	}
+
+	return str, jsonETag(str), true, nil
+}
+
+func (h *Handler) write(w http.ResponseWriter, r *http.Request, path string) error {
+	var body Node
+
+	if r.Method != http.MethodDelete {
+		reader := r.Body
+		if h.MaxBody > 0 {
+			reader = http.MaxBytesReader(w, r.Body, h.MaxBody)
+		}
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return httpErrorf(http.StatusRequestEntityTooLarge, "%v", err)
+		}
+		holder, err := Parse(data)
+		if err != nil {
+			return httpErrorf(http.StatusBadRequest, "invalid JSON: %v", err)
+		}
+		body = holder.Data
+	}
+
+	//If-Match/If-None-Match 在写锁内检查
+	ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	created := false
+	check := func(node Node, exist bool) error {
+		if ifMatch != "" && (!exist || !matchETag(ifMatch, nodeETag(node), false)) {
+			return httpErrorf(http.StatusPreconditionFailed, "If-Match does not match")
+		}
+		if ifNoneMatch != "" && exist && matchETag(ifNoneMatch, nodeETag(node), false) {
+			return httpErrorf(http.StatusPreconditionFailed, "If-None-Match matches")
+		}
+		created = !exist
+		return nil
+	}
+
+	var err error
+	switch r.Method {
+	case http.MethodPut:
+		err = h.Holder.modify(path, OpSet, check, func(node Node, exist bool) (Node, error) {
+			return body, nil
+		})
+	case http.MethodPost:
+		return h.post(w, r, path, body, check)
+	case http.MethodPatch:
+		err = h.patch(r, path, body, check)
+	case http.MethodDelete:
+		return h.del(w, path, check)
+	}
+	if err != nil {
+		return err
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	return h.replyNode(w, r, status, path)
+}
+
+func (h *Handler) patch(r *http.Request, path string, body Node, check func(Node, bool) error) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "application/json-patch+json":
+		ops, err := ParsePatch(body)
+		if err != nil {
+			return httpErrorf(http.StatusBadRequest, "%v", err)
+		}
+		err = h.Holder.modify(path, OpPatch, check, func(node Node, exist bool) (Node, error) {
+			if !exist {
+				return nil, httpErrorf(http.StatusNotFound, "Path(%v) not found", path)
+			}
+			node, err := applyOps(node, ops)
+			if err != nil {
+				return nil, httpErrorf(http.StatusConflict, "%v", err)
+			}
+			return node, nil
+		})
+		return err
+	case "application/merge-patch+json", "application/json", "":
+		return h.Holder.modify(path, OpMerge, check, func(node Node, exist bool) (Node, error) {
+			return mergeNode(node, body), nil
+		})
+	}
+
+	return httpErrorf(http.StatusUnsupportedMediaType, "unsupported patch type %q", mediaType)
+}
+
+func (h *Handler) post(w http.ResponseWriter, r *http.Request, path string, body Node, check func(Node, bool) error) error {
+	var newPath string
+
+	err := h.Holder.modify(path, OpSet, check, func(node Node, exist bool) (Node, error) {
+		items, ok := asArry(node)
+		if !exist || !ok {
+			return nil, httpErrorf(http.StatusConflict, "Path(%v) is not an array", path)
+		}
+		newPath = joinIndex(path, len(items))
+		return append(items, body), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Location", h.Prefix+newPath)
+	return h.replyNode(w, r, http.StatusCreated, newPath)
+}
+
+func (h *Handler) del(w http.ResponseWriter, path string, check func(Node, bool) error) error {
+	if path == "/" {
+		return httpErrorf(http.StatusMethodNotAllowed, "can not delete root node")
+	}
+
+	err := h.Holder.Update(func(tx *Tx) error {
+		node, exist := tx.holder.lookup(path)
+		if !exist {
+			return httpErrorf(http.StatusNotFound, "Path(%v) not found", path)
+		}
+		if err := check(node, exist); err != nil {
+			return err
+		}
+		return tx.Del(path)
+	})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// 返回写入后的结点
+func (h *Handler) replyNode(w http.ResponseWriter, r *http.Request, status int, path string) error {
+	str, etag, _, err := h.lookupJson(path)
+	if err != nil {
+		return httpErrorf(http.StatusInternalServerError, "%v", err)
+	}
+
+	h.replyJson(w, r, status, str, etag)
+	return nil
+}
+
+func (h *Handler) reply(w http.ResponseWriter, r *http.Request, status int, node Node, etag string) {
+	str, err := FormatJson(node, "")
+	if err != nil {
+		status, str = http.StatusInternalServerError, `{"error":`+strconv.Quote(err.Error())+`}`
+	}
+
+	h.replyJson(w, r, status, str, etag)
+}
+
+// 输出已序列化的JSON
+func (h *Handler) replyJson(w http.ResponseWriter, r *http.Request, status int, str, etag string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(str)+1))
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	w.WriteHeader(status)
+
+	if r.Method != http.MethodHead {
+		w.Write([]byte(str + "\n"))
+	}
+}
+
+// If-Match/If-None-Match 是否包含etag; weak=true 时忽略 W/ 前缀(弱比较)
+func matchETag(header, etag string, weak bool) bool {
+	if header == "" {
+		return false
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,196 @@
+package jsnx
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestHandler(t *testing.T, readOnly bool) (*Handler, *JsonHolder) {
+	holder, err := NewJsonHolder(`{"server":{"host":"a","port":80},"items":[1,2]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewHandler(holder, "/config", readOnly), holder
+}
+
+func serve(h http.Handler, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerETag(t *testing.T) {
+	h, holder := newTestHandler(t, false)
+
+	rec := serve(h, http.MethodGet, "/config/server", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET status %d: %s", rec.Code, rec.Body)
+	}
+	etag := rec.Header().Get("ETag")
+	if want, _ := holder.ETag("/server"); etag == "" || etag != want {
+		t.Fatalf("ETag %q, want %q", etag, want)
+	}
+
+	//未修改
+	rec = serve(h, http.MethodGet, "/config/server", "", map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("If-None-Match: status %d body %q, want 304", rec.Code, rec.Body)
+	}
+	rec = serve(h, http.MethodGet, "/config/server", "", map[string]string{"If-None-Match": "W/" + etag})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("weak If-None-Match: status %d, want 304", rec.Code)
+	}
+
+	//If-Match 不匹配时不修改
+	rec = serve(h, http.MethodPut, "/config/server/port", "81", map[string]string{"If-Match": `"stale"`})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale If-Match: status %d, want 412", rec.Code)
+	}
+	if port, _ := holder.GetInt("/server/port"); port != 80 {
+		t.Errorf("port changed to %d by failed PUT", port)
+	}
+
+	rec = serve(h, http.MethodPatch, "/config/server", `{"port":82}`, map[string]string{"If-Match": etag})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH with If-Match: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("ETag") == etag {
+		t.Errorf("ETag not changed after PATCH")
+	}
+
+	//修改后原ETag 不再匹配
+	rec = serve(h, http.MethodGet, "/config/server", "", map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusOK {
+		t.Errorf("If-None-Match after change: status %d, want 200", rec.Code)
+	}
+	rec = serve(h, http.MethodDelete, "/config/server", "", map[string]string{"If-Match": etag})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("DELETE with old If-Match: status %d, want 412", rec.Code)
+	}
+
+	//If-None-Match: * 只在结点不存在时写入
+	rec = serve(h, http.MethodPut, "/config/server", `{}`, map[string]string{"If-None-Match": "*"})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("If-None-Match * on existing node: status %d, want 412", rec.Code)
+	}
+	rec = serve(h, http.MethodPut, "/config/db", `{"name":"x"}`, map[string]string{"If-None-Match": "*"})
+	if rec.Code != http.StatusCreated {
+		t.Errorf("If-None-Match * on new node: status %d, want 201", rec.Code)
+	}
+	rec = serve(h, http.MethodPut, "/config/cache", `1`, map[string]string{"If-Match": "*"})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("If-Match * on missing node: status %d, want 412", rec.Code)
+	}
+}
+
+func TestHandlerReadOnly(t *testing.T) {
+	h, holder := newTestHandler(t, true)
+
+	for _, method := range []string{http.MethodPut, http.MethodPost, http.MethodPatch, http.MethodDelete} {
+		rec := serve(h, method, "/config/items", `3`, nil)
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s: status %d, want 405", method, rec.Code)
+		}
+		if allow := rec.Header().Get("Allow"); allow != "GET, HEAD" {
+			t.Errorf("%s: Allow %q", method, allow)
+		}
+	}
+
+	if n, _ := holder.ArryLen("/items"); n != 2 {
+		t.Errorf("items changed in read-only mode: len %d", n)
+	}
+
+	rec := serve(h, http.MethodHead, "/config/items", "", nil)
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 || rec.Header().Get("ETag") == "" {
+		t.Errorf("HEAD: status %d body %q", rec.Code, rec.Body)
+	}
+}
+
+func TestHandlerMaxBody(t *testing.T) {
+	h, holder := newTestHandler(t, false)
+	h.MaxBody = 16
+
+	rec := serve(h, http.MethodPut, "/config/name", `"`+strings.Repeat("x", 32)+`"`, nil)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body: status %d, want 413", rec.Code)
+	}
+	if _, exist := holder.Lookup("/name"); exist {
+		t.Errorf("large body written")
+	}
+
+	rec = serve(h, http.MethodPut, "/config/name", `"short"`, nil)
+	if rec.Code != http.StatusCreated {
+		t.Errorf("small body: status %d, want 201: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	h, _ := newTestHandler(t, false)
+
+	tests := []struct {
+		method, target, body string
+		status               int
+	}{
+		{http.MethodGet, "/config/missing", "", http.StatusNotFound},
+		{http.MethodGet, "/other/server", "", http.StatusNotFound},
+		{http.MethodGet, "/configx", "", http.StatusNotFound},
+		{http.MethodPut, "/config/server", "{", http.StatusBadRequest},
+		{http.MethodPost, "/config/server", "1", http.StatusConflict},
+		{http.MethodDelete, "/config", "", http.StatusMethodNotAllowed},
+		{http.MethodOptions, "/config", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		rec := serve(h, tt.method, tt.target, tt.body, nil)
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: status %d, want %d: %s", tt.method, tt.target, rec.Code, tt.status, rec.Body)
+		}
+	}
+
+	rec := serve(h, http.MethodPost, "/config/items", "3", nil)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Location") != "/config/items/2" {
+		t.Errorf("POST: status %d Location %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+// 读取与写入同时进行, 需要配合 -race 运行: 响应在读锁内序列化, ETag 与响应内容一致
+func TestHandlerConcurrent(t *testing.T) {
+	h, _ := newTestHandler(t, false)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				serve(h, http.MethodPut, "/config/server/port", fmt.Sprint(i), nil)
+				serve(h, http.MethodPatch, "/config/server", fmt.Sprintf(`{"w%d":%d}`, w, i), nil)
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				rec := serve(h, http.MethodGet, "/config/server", "", nil)
+				if rec.Code != http.StatusOK {
+					t.Errorf("GET status %d", rec.Code)
+					return
+				}
+				if etag := rec.Header().Get("ETag"); etag != jsonETag(strings.TrimSuffix(rec.Body.String(), "\n")) {
+					t.Errorf("ETag %s does not match body %s", etag, rec.Body)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
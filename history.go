@@ -0,0 +1,303 @@
+package jsnx
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// 修改历史(持有holder写锁时访问)
+type history struct {
+	limit      int         //最多保留的记录数, <=0 时不限制
+	maxBytes   int         //可撤消记录的估计大小上限(字节), <=0 时不限制
+	bytes      int         //可撤消记录的估计大小
+	undo       []*histItem //可撤消的记录
+	redo       []*histItem //可重做的记录
+	group      *histItem   //当前分组
+	groupLabel string
+	groupDepth int
+}
+
+// 一条历史记录: 修改前后的数据(写时复制, 共享未修改的结点)
+type histItem struct {
+	label  string
+	before interface{}
+	after  interface{}
+	size   int //估计大小: 撤消操作的JSON 长度, 即记录独占的修改前数据
+}
+
+// 历史记录(JSON Patch 格式)
+type HistoryRecord struct {
+	Label   string    `json:"label,omitempty"`
+	Patch   []PatchOp `json:"patch"`   //正向操作
+	Inverse []PatchOp `json:"inverse"` //撤消操作
+}
+
+func (h *history) record(before, after interface{}, label string) {
+	if sameNode(before, after) {
+		return
+	}
+
+	if h.groupDepth > 0 {
+		if h.group == nil {
+			h.group = &histItem{label: h.groupLabel, before: before}
+		}
+		h.group.after = after
+		return
+	}
+
+	h.push(&histItem{label: label, before: before, after: after})
+}
+
+func (h *history) push(item *histItem) {
+	if h.maxBytes > 0 {
+		item.size = patchSize(Diff(item.after, item.before))
+	}
+	h.undo = append(h.undo, item)
+	h.bytes += item.size
+	h.redo = nil
+	h.trim()
+}
+
+// 按记录数及估计大小删除最早的记录; 单条记录超过大小上限时也被删除
+func (h *history) trim() {
+	drop := 0
+	if h.limit > 0 && len(h.undo) > h.limit {
+		drop = len(h.undo) - h.limit
+	}
+	for i := 0; i < drop; i++ {
+		h.bytes -= h.undo[i].size
+	}
+	for h.maxBytes > 0 && h.bytes > h.maxBytes && drop < len(h.undo) {
+		h.bytes -= h.undo[drop].size
+		drop++
+	}
+
+	if drop > 0 {
+		h.undo = append(h.undo[:0:0], h.undo[drop:]...)
+	}
+}
+
+// JSON Patch 序列化后的长度
+func patchSize(ops []PatchOp) int {
+	data, err := json.Marshal(ops)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// 开启修改历史, limit 为最多保留的记录数(<=0 时不限制); maxBytes 可选, 为可撤消记录的估计大小上限
+// (按撤消操作的JSON 长度估计, <=0 时不限制), 超过时删除最早的记录; 已开启时只修改限制
+func (holder *JsonHolder) EnableHistory(limit int, maxBytes ...int) {
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+
+	h := holder.history
+	if h == nil {
+		h = &history{}
+		holder.history = h
+	}
+	h.limit = limit
+	if len(maxBytes) > 0 {
+		if maxBytes[0] > 0 && h.maxBytes <= 0 {
+			//之前未估计大小的记录
+			h.bytes = 0
+			for _, item := range append(h.undo[:len(h.undo):len(h.undo)], h.redo...) {
+				item.size = patchSize(Diff(item.after, item.before))
+			}
+			for _, item := range h.undo {
+				h.bytes += item.size
+			}
+		}
+		h.maxBytes = maxBytes[0]
+	}
+	h.trim()
+}
+
+// 关闭修改历史, 并清除已有记录
+func (holder *JsonHolder) DisableHistory() {
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+
+	holder.history = nil
+}
+
+// 开始分组: 到对应的EndGroup 为止的修改作为一条记录撤消/重做, 可嵌套
+func (holder *JsonHolder) BeginGroup(label string) {
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+
+	h := holder.history
+	if h == nil {
+		return
+	}
+
+	if h.groupDepth == 0 {
+		h.group = nil
+		h.groupLabel = label
+	}
+	h.groupDepth++
+}
+
+// 结束分组
+func (holder *JsonHolder) EndGroup() {
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+
+	h := holder.history
+	if h == nil || h.groupDepth == 0 {
+		return
+	}
+
+	h.groupDepth--
+	if h.groupDepth == 0 && h.group != nil {
+		h.push(h.group)
+		h.group = nil
+	}
+}
+
+// 是否可撤消
+func (holder *JsonHolder) CanUndo() bool {
+	holder.mu.RLock()
+	defer holder.mu.RUnlock()
+
+	return holder.history != nil && len(holder.history.undo) > 0
+}
+
+// 是否可重做
+func (holder *JsonHolder) CanRedo() bool {
+	holder.mu.RLock()
+	defer holder.mu.RUnlock()
+
+	return holder.history != nil && len(holder.history.redo) > 0
+}
+
+// 撤消最近一次修改
+func (holder *JsonHolder) Undo() error {
+	holder.mu.Lock()
+
+	h := holder.history
+	if err := holder.checkHistory(); err != nil {
+		holder.mu.Unlock()
+		return err
+	}
+
+	if len(h.undo) == 0 {
+		holder.mu.Unlock()
+		return fmt.Errorf("nothing to undo")
+	}
+
+	item := h.undo[len(h.undo)-1]
+	ev := ChangeEvent{Path: "/", Op: OpUndo, OldValue: holder.Data, NewValue: item.before}
+	if holder.oplog != nil {
+		if err := holder.oplog.append(holder.actor, []ChangeEvent{ev}); err != nil {
+			holder.mu.Unlock()
+			return err
+		}
+	}
+
+	h.undo = h.undo[:len(h.undo)-1]
+	h.bytes -= item.size
+	h.redo = append(h.redo, item)
+
+	holder.Data = item.before
+	holder.freeze()
+	holder.persist([]ChangeEvent{ev})
+	holder.mu.Unlock()
+
+	holder.notify(ev)
+	return nil
+}
+
+// 重做最近一次撤消的修改
+func (holder *JsonHolder) Redo() error {
+	holder.mu.Lock()
+
+	h := holder.history
+	if err := holder.checkHistory(); err != nil {
+		holder.mu.Unlock()
+		return err
+	}
+
+	if len(h.redo) == 0 {
+		holder.mu.Unlock()
+		return fmt.Errorf("nothing to redo")
+	}
+
+	item := h.redo[len(h.redo)-1]
+	ev := ChangeEvent{Path: "/", Op: OpRedo, OldValue: holder.Data, NewValue: item.after}
+	if holder.oplog != nil {
+		if err := holder.oplog.append(holder.actor, []ChangeEvent{ev}); err != nil {
+			holder.mu.Unlock()
+			return err
+		}
+	}
+
+	h.redo = h.redo[:len(h.redo)-1]
+	h.undo = append(h.undo, item)
+	h.bytes += item.size
+
+	holder.Data = item.after
+	holder.freeze()
+	holder.persist([]ChangeEvent{ev})
+	holder.mu.Unlock()
+
+	holder.notify(ev)
+	return nil
+}
+
+func (holder *JsonHolder) checkHistory() error {
+	if holder.history == nil {
+		return fmt.Errorf("history not enabled")
+	}
+
+	if holder.history.groupDepth > 0 {
+		return fmt.Errorf("history group not ended")
+	}
+
+	return nil
+}
+
+// 获取可撤消的历史记录(从旧到新), 每条记录为正向及撤消的JSON Patch
+func (holder *JsonHolder) History() []HistoryRecord {
+	holder.mu.RLock()
+	defer holder.mu.RUnlock()
+
+	if holder.history == nil {
+		return nil
+	}
+
+	records := make([]HistoryRecord, 0, len(holder.history.undo))
+	for _, item := range holder.history.undo {
+		records = append(records, HistoryRecord{
+			Label:   item.label,
+			Patch:   Diff(item.before, item.after),
+			Inverse: Diff(item.after, item.before),
+		})
+	}
+
+	return records
+}
+
+// 历史记录序列化为JSON Patch 日志
+func (holder *JsonHolder) HistoryJson(formatter string) (string, error) {
+	records := holder.History()
+	if records == nil {
+		records = make([]HistoryRecord, 0)
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if formatter == "" {
+		data, err = json.Marshal(records)
+	} else {
+		data, err = json.MarshalIndent(records, "", formatter)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,89 @@
+package jsnx
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHistoryUndoRedo(t *testing.T) {
+	holder, _ := NewJsonHolder(`{"a":1}`)
+	holder.EnableHistory(2)
+
+	holder.SetJson("/a", 2)
+	holder.SetJson("/a", 3)
+	holder.SetJson("/a", 4)
+
+	//只保留最近2条记录
+	if n := len(holder.History()); n != 2 {
+		t.Fatalf("%d records, want 2", n)
+	}
+	for _, want := range []int{3, 2} {
+		if err := holder.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		if a, _ := holder.GetInt("/a"); a != want {
+			t.Errorf("a = %d after undo, want %d", a, want)
+		}
+	}
+	if err := holder.Undo(); err == nil {
+		t.Error("undo beyond limit")
+	}
+
+	if err := holder.Redo(); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := holder.GetInt("/a"); a != 3 {
+		t.Errorf("a = %d after redo, want 3", a)
+	}
+}
+
+// 按撤消数据的估计大小限制历史记录
+func TestHistoryMaxBytes(t *testing.T) {
+	big := strings.Repeat("x", 1000)
+	holder, _ := NewJsonHolder(`{"a":1,"big":"` + big + `"}`)
+	holder.EnableHistory(0, 500)
+
+	holder.SetJson("/a", 2)
+	holder.SetJson("/a", 3)
+	if n := len(holder.History()); n != 2 {
+		t.Fatalf("%d records, want 2", n)
+	}
+
+	//撤消记录需要保留big 的原值, 超过上限, 全部记录被删除
+	holder.SetJson("/big", "y")
+	if holder.CanUndo() {
+		t.Errorf("records kept beyond maxBytes: %v", holder.History())
+	}
+
+	//之后的小修改仍然记录, 并删除最早的记录直到不超过上限
+	for i := 0; i < 30; i++ {
+		holder.SetJson("/a", i)
+	}
+	records := holder.History()
+	if len(records) == 0 || len(records) == 30 {
+		t.Fatalf("%d records with maxBytes", len(records))
+	}
+	if size := patchSize(records[0].Inverse) * len(records); size > 500 {
+		t.Errorf("estimated size %d > 500", size)
+	}
+	for range records {
+		if err := holder.Undo(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a, _ := holder.GetInt("/a"); a != 29-len(records) {
+		t.Errorf("a = %d, want %d", a, 29-len(records))
+	}
+	if big, _ := holder.GetString("/big"); big != "y" {
+		t.Errorf("big restored beyond maxBytes")
+	}
+
+	//撤消后重做的记录计入大小
+	for range records {
+		holder.Redo()
+	}
+	holder.EnableHistory(0, 1)
+	if holder.CanUndo() {
+		t.Error("records kept after lowering maxBytes")
+	}
+}
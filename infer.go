@@ -0,0 +1,247 @@
+package jsnx
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// JSON 类型输出顺序
+var inferTypes = []string{"null", "boolean", "integer", "number", "string", "array", "object"}
+
+// 字符串format 候选
+var inferFormats = []string{"date-time", "date", "email", "uuid"}
+
+// 由样本数据推断JSON Schema(2020-12), 可以多次Add 合并观察结果
+type SchemaInferrer struct {
+	EnumLimit int //字符串不同取值不超过该数量且有重复时生成enum, 0 为默认值10, <0 不生成
+
+	mu   sync.Mutex
+	root *shape
+}
+
+// 观察到的结点形态
+type shape struct {
+	count int            //出现次数(含null)
+	types map[string]int //类型 -> 次数
+
+	//对象
+	objects int
+	props   map[string]*shape
+
+	//数组
+	items    *shape
+	minItems int
+	maxItems int
+
+	//数字
+	min, max float64
+
+	//字符串
+	values   map[string]bool
+	overflow bool            //不同取值过多, 不再生成enum
+	formats  map[string]bool //所有取值都满足的format
+}
+
+func newShape() *shape {
+	return &shape{types: make(map[string]int), props: make(map[string]*shape)}
+}
+
+func NewSchemaInferrer() *SchemaInferrer {
+	return &SchemaInferrer{root: newShape()}
+}
+
+// 增加一个样本
+func (in *SchemaInferrer) Add(holder *JsonHolder) {
+	holder.mu.RLock()
+	defer holder.mu.RUnlock()
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	if in.root == nil {
+		in.root = newShape()
+	}
+	in.root.observe(holder.Data, in.enumLimit())
+}
+
+// 推断结果
+func (in *SchemaInferrer) Schema() *JsonHolder {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	if in.root == nil {
+		in.root = newShape()
+	}
+
+	schema := in.root.schema()
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	return Holder(schema)
+}
+
+func (in *SchemaInferrer) enumLimit() int {
+	if in.EnumLimit == 0 {
+		return 10
+	}
+
+	return in.EnumLimit
+}
+
+// 由一个或多个样本推断JSON Schema
+func InferSchema(samples ...*JsonHolder) *JsonHolder {
+	in := NewSchemaInferrer()
+	for _, sample := range samples {
+		in.Add(sample)
+	}
+
+	return in.Schema()
+}
+
+// 记录一个结点, 数组的全部元素合并为一个形态
+func (s *shape) observe(node Node, enumLimit int) {
+	s.count++
+
+	name := typeName(node)
+	s.types[name]++
+
+	switch name {
+	case "object":
+		mapNode := node.(MapNode)
+		s.objects++
+		for key, value := range mapNode {
+			prop, exist := s.props[key]
+			if !exist {
+				prop = newShape()
+				s.props[key] = prop
+			}
+			prop.observe(value, enumLimit)
+		}
+	case "array":
+		items, _ := asArry(node)
+		if s.types["array"] == 1 || len(items) < s.minItems {
+			s.minItems = len(items)
+		}
+		if len(items) > s.maxItems {
+			s.maxItems = len(items)
+		}
+		if len(items) > 0 && s.items == nil {
+			s.items = newShape()
+		}
+		for _, item := range items {
+			s.items.observe(item, enumLimit)
+		}
+	case "integer", "number":
+		f, _ := toFloat(node)
+		if s.types["integer"]+s.types["number"] == 1 {
+			s.min, s.max = f, f
+		} else {
+			s.min, s.max = math.Min(s.min, f), math.Max(s.max, f)
+		}
+	case "string":
+		str := node.(string)
+
+		if s.formats == nil {
+			s.formats = make(map[string]bool)
+			for _, format := range inferFormats {
+				s.formats[format] = true
+			}
+		}
+		for format := range s.formats {
+			if !schemaFormats[format](str) {
+				delete(s.formats, format)
+			}
+		}
+
+		if enumLimit > 0 && !s.overflow {
+			if s.values == nil {
+				s.values = make(map[string]bool)
+			}
+			s.values[str] = true
+			if len(s.values) > enumLimit {
+				s.overflow, s.values = true, nil
+			}
+		}
+	}
+}
+
+// 生成schema
+func (s *shape) schema() MapNode {
+	schema := MapNode{}
+
+	types := make([]interface{}, 0)
+	for _, name := range inferTypes {
+		if s.types[name] == 0 || (name == "integer" && s.types["number"] > 0) {
+			continue //整数和小数都出现时为number
+		}
+		types = append(types, name)
+	}
+	if len(types) == 1 {
+		schema["type"] = types[0]
+	} else if len(types) > 1 {
+		schema["type"] = types
+	}
+
+	if s.objects > 0 {
+		properties := MapNode{}
+		required := make([]interface{}, 0)
+		keys := make([]string, 0, len(s.props))
+		for key := range s.props {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			prop := s.props[key]
+			properties[key] = prop.schema()
+			if prop.count == s.objects {
+				required = append(required, key)
+			}
+		}
+		schema["properties"] = properties
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+	}
+
+	if s.types["array"] > 0 {
+		if s.items != nil {
+			schema["items"] = s.items.schema()
+		}
+		schema["minItems"] = s.minItems
+		schema["maxItems"] = s.maxItems
+	}
+
+	if s.types["integer"]+s.types["number"] > 0 {
+		schema["minimum"] = s.min
+		schema["maximum"] = s.max
+	}
+
+	if s.types["string"] > 0 {
+		for _, format := range inferFormats {
+			if s.formats[format] {
+				schema["format"] = format
+				break
+			}
+		}
+
+		//不同取值有重复时作为enum 候选
+		if schema["format"] == nil && !s.overflow && len(s.values) > 0 && len(s.values) < s.types["string"] && len(types) <= 2 &&
+			(len(types) == 1 || s.types["null"] > 0) {
+			values := make([]string, 0, len(s.values))
+			for value := range s.values {
+				values = append(values, value)
+			}
+			sort.Strings(values)
+
+			enum := make([]interface{}, 0, len(values)+1)
+			for _, value := range values {
+				enum = append(enum, value)
+			}
+			if s.types["null"] > 0 {
+				enum = append(enum, nil)
+			}
+			schema["enum"] = enum
+		}
+	}
+
+	return schema
+}
@@ -0,0 +1,114 @@
+package jsnx
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func inferSamples(t *testing.T, docs ...string) []*JsonHolder {
+	samples := make([]*JsonHolder, len(docs))
+	for i, doc := range docs {
+		holder, err := NewJsonHolder(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		samples[i] = holder
+	}
+
+	return samples
+}
+
+func TestInferSchema(t *testing.T) {
+	samples := inferSamples(t,
+		`{"id":1,"name":"a","status":"on","score":1.5,"when":"2024-01-02","tags":["x"],"meta":{"k":1}}`,
+		`{"id":2,"name":"b","status":"off","score":2,"when":"2024-02-03","tags":[],"note":null}`,
+		`{"id":3,"name":"c","status":"on","score":3,"when":"2024-03-04","tags":["y","z"],"note":"n"}`,
+	)
+	schema := InferSchema(samples...)
+
+	tests := []struct {
+		path string
+		want Node
+	}{
+		{"/$schema", "https://json-schema.org/draft/2020-12/schema"},
+		{"/type", "object"},
+		{"/required", ArryNode{"id", "name", "score", "status", "tags", "when"}},
+		{"/properties/id", MapNode{"type": "integer", "minimum": 1.0, "maximum": 3.0}},
+		{"/properties/score/type", "number"},
+		{"/properties/status/enum", ArryNode{"off", "on"}},
+		{"/properties/when", MapNode{"type": "string", "format": "date"}},
+		{"/properties/tags/minItems", 0},
+		{"/properties/tags/maxItems", 2},
+		{"/properties/tags/items/type", "string"},
+		{"/properties/note/type", ArryNode{"null", "string"}},
+		{"/properties/meta/required", ArryNode{"k"}},
+	}
+	for _, tt := range tests {
+		got, err := schema.Get(tt.path)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, %v, want %#v", tt.path, got, err, tt.want)
+		}
+	}
+
+	//取值都不同时不生成enum
+	if _, exist := schema.Lookup("/properties/name/enum"); exist {
+		t.Error("enum generated for distinct values")
+	}
+
+	//推断的schema 可以校验全部样本
+	compiled, err := CompileSchema(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, sample := range samples {
+		if err = sample.Validate("/", compiled); err != nil {
+			t.Errorf("sample %d: %v", i, err)
+		}
+	}
+}
+
+func TestInferSchemaEnumLimit(t *testing.T) {
+	in := NewSchemaInferrer()
+	in.EnumLimit = 2
+	for _, sample := range inferSamples(t, `{"c":"a"}`, `{"c":"b"}`, `{"c":"a"}`, `{"c":"c"}`) {
+		in.Add(sample)
+	}
+	if _, exist := in.Schema().Lookup("/properties/c/enum"); exist {
+		t.Error("enum generated beyond EnumLimit")
+	}
+
+	in = NewSchemaInferrer()
+	in.EnumLimit = -1
+	for _, sample := range inferSamples(t, `{"c":"a"}`, `{"c":"a"}`) {
+		in.Add(sample)
+	}
+	if _, exist := in.Schema().Lookup("/properties/c/enum"); exist {
+		t.Error("enum generated with EnumLimit < 0")
+	}
+}
+
+// 可以从多个goroutine 增加样本, 需要配合 -race 运行
+func TestInferSchemaConcurrent(t *testing.T) {
+	in := NewSchemaInferrer()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			holder, _ := NewJsonHolder(`{"n":` + strconv.Itoa(i) + `}`)
+			in.Add(holder)
+		}(i)
+	}
+	wg.Wait()
+
+	schema := in.Schema()
+	if min, _ := schema.GetInt("/properties/n/minimum"); min != 0 {
+		t.Errorf("minimum %d", min)
+	}
+	if max, _ := schema.GetInt("/properties/n/maximum"); max != 7 {
+		t.Errorf("maximum %d", max)
+	}
+}
@@ -0,0 +1,274 @@
+package jsnx
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// 未能解析的引用
+type UnresolvedRef struct {
+	Path   string //引用所在结点
+	Ref    string //引用表达式(${} 内的内容)
+	Reason string //not found, cycle
+}
+
+func (u UnresolvedRef) String() string {
+	return fmt.Sprintf("Path(%v) ${%s}: %s", u.Path, u.Ref, u.Reason)
+}
+
+// 解析字符串值中的引用:
+//
+//	${/server/host}     引用其它结点(被引用的值也会解析), 整个字符串只有一个引用时保留原类型
+//	${env:HOME}         环境变量, 不以 / 开头时 env: 可以省略
+//	${X:-fallback}      X 不存在或为空时使用fallback, fallback 中也可以有引用
+//	$${                 输出 ${
+//
+// 循环引用及不存在的引用保留原文, 并在返回的列表中报告;
+// inPlace=true 时写回holder, 否则返回新的holder
+func (holder *JsonHolder) Interpolate(inPlace ...bool) (*JsonHolder, []UnresolvedRef, error) {
+	if len(inPlace) > 0 && inPlace[0] {
+		var unresolved []UnresolvedRef
+		err := holder.modify("/", OpReplace, nil, func(node Node, exist bool) (Node, error) {
+			ip := newInterpolator(node)
+			node = ip.run("/", node)
+			unresolved = ip.unresolved
+			return node, nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return holder, unresolved, nil
+	}
+
+	holder.mu.RLock()
+	ip := newInterpolator(holder.Data)
+	data := ip.run("/", holder.Data)
+	holder.mu.RUnlock()
+
+	return Holder(data), ip.unresolved, nil
+}
+
+func Interpolate(data interface{}, inPlace ...bool) (*JsonHolder, []UnresolvedRef, error) {
+	jsx := &JsonHolder{Data: data}
+	return jsx.Interpolate(inPlace...)
+}
+
+// 获取字符串并解析其中的引用(不修改holder), 有未能解析的引用时返回错误
+func (holder *JsonHolder) GetStringExpanded(path string) (string, error) {
+	holder.mu.RLock()
+	node, exist := holder.lookup(path)
+	var ip *interpolator
+	if exist {
+		ip = newInterpolator(holder.Data)
+		node = ip.run(cleanPath(path), node)
+	}
+	holder.mu.RUnlock()
+
+	if !exist {
+		return "", fmt.Errorf("Path(%v) not found", cleanPath(path))
+	}
+	if len(ip.unresolved) > 0 {
+		return "", fmt.Errorf("unresolved reference %v", ip.unresolved[0])
+	}
+
+	return (&JsonHolder{Data: node}).GetString("/")
+}
+
+type interpolator struct {
+	root       *JsonHolder
+	resolving  map[string]bool //正在解析的结点, 用于检测循环引用
+	done       map[string]Node //已解析的结点
+	cyclic     map[string]bool //依赖循环引用的结点, 引用它们的结点也不解析
+	unresolved []UnresolvedRef
+	reported   map[UnresolvedRef]bool
+	cycles     int //检测到的循环引用次数
+}
+
+func newInterpolator(root Node) *interpolator {
+	return &interpolator{
+		root:      &JsonHolder{Data: root},
+		resolving: make(map[string]bool),
+		done:      make(map[string]Node),
+		cyclic:    make(map[string]bool),
+		reported:  make(map[UnresolvedRef]bool),
+	}
+}
+
+// 解析结点, 未能解析的引用按路径排序
+func (ip *interpolator) run(path string, node Node) Node {
+	result := ip.resolve(path, node)
+	sort.Slice(ip.unresolved, func(i, j int) bool {
+		a, b := ip.unresolved[i], ip.unresolved[j]
+		return a.Path < b.Path || (a.Path == b.Path && a.Ref < b.Ref)
+	})
+
+	return result
+}
+
+// 解析结点(返回新结点, 不修改原数据)
+func (ip *interpolator) resolve(path string, node Node) Node {
+	if v, ok := ip.done[path]; ok {
+		return v
+	}
+
+	ip.resolving[path] = true
+	defer delete(ip.resolving, path)
+
+	cycles := ip.cycles
+	defer func() {
+		if ip.cycles > cycles {
+			ip.cyclic[path] = true
+		}
+	}()
+
+	var result Node
+	switch n := node.(type) {
+	case MapNode:
+		m := make(MapNode, len(n))
+		for key, value := range n {
+			m[key] = ip.resolve(joinKey(path, key), value)
+		}
+		result = m
+	case ArryNode, ArryMapNode:
+		items, _ := asArry(n)
+		a := make(ArryNode, len(items))
+		for i, value := range items {
+			a[i] = ip.resolve(joinIndex(path, i), value)
+		}
+		result = a
+	case string:
+		result = ip.expand(path, n)
+	default:
+		result = node
+	}
+
+	ip.done[path] = result
+	return result
+}
+
+// 展开字符串中的引用
+func (ip *interpolator) expand(path, str string) Node {
+	if !strings.Contains(str, "${") {
+		return str
+	}
+
+	buff := strings.Builder{}
+	for i := 0; i < len(str); {
+		if strings.HasPrefix(str[i:], "$${") {
+			buff.WriteString("${")
+			i += 3
+			continue
+		}
+		if !strings.HasPrefix(str[i:], "${") {
+			buff.WriteByte(str[i])
+			i++
+			continue
+		}
+
+		end := refEnd(str, i+2)
+		if end < 0 {
+			//没有结束的 }, 原样输出
+			buff.WriteString(str[i:])
+			break
+		}
+
+		value, ok := ip.ref(path, str[i+2:end])
+		if ok && i == 0 && end == len(str)-1 {
+			//整个字符串为一个引用, 保留原类型
+			return value
+		}
+
+		if !ok {
+			buff.WriteString(str[i : end+1])
+		} else if s, isStr := value.(string); isStr {
+			buff.WriteString(s)
+		} else if value != nil {
+			s, err := FormatJson(value, "")
+			if err != nil {
+				s = fmt.Sprint(value)
+			}
+			buff.WriteString(s)
+		}
+		i = end + 1
+	}
+
+	return buff.String()
+}
+
+// 查找引用结束的 } (允许嵌套的 ${})
+func refEnd(str string, start int) int {
+	depth := 0
+	for i := start; i < len(str); i++ {
+		switch {
+		case strings.HasPrefix(str[i:], "${"):
+			depth++
+			i++
+		case str[i] == '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+
+	return -1
+}
+
+// 解析一个引用表达式
+func (ip *interpolator) ref(path, expr string) (Node, bool) {
+	name, fallback, hasDefault := expr, "", false
+	if idx := strings.Index(expr, ":-"); idx >= 0 {
+		name, fallback, hasDefault = expr[:idx], expr[idx+2:], true
+	}
+
+	var (
+		value  Node
+		reason string
+	)
+	if strings.HasPrefix(name, "/") {
+		refPath := cleanPath(name)
+		node, exist := ip.root.lookup(refPath)
+		switch {
+		case !exist:
+			reason = "not found"
+		case ip.resolving[refPath]:
+			reason = "cycle"
+		default:
+			//被引用的结点依赖循环引用时(包括之前已解析的), 本引用也不解析
+			value = ip.resolve(refPath, node)
+			if ip.cyclic[refPath] {
+				reason = "cycle"
+			}
+		}
+	} else {
+		env, exist := os.LookupEnv(strings.TrimPrefix(name, "env:"))
+		if exist {
+			value = env
+		} else {
+			reason = "not found"
+		}
+	}
+
+	//循环引用总是报告, 不存在的引用有默认值时不报告
+	if reason == "cycle" {
+		ip.cycles++
+	}
+	if reason == "cycle" || (reason != "" && !hasDefault) {
+		u := UnresolvedRef{Path: path, Ref: expr, Reason: reason}
+		if !ip.reported[u] {
+			ip.reported[u] = true
+			ip.unresolved = append(ip.unresolved, u)
+		}
+	}
+
+	if hasDefault && (reason != "" || value == nil || value == "") {
+		return ip.expand(path, fallback), true
+	}
+	if reason != "" {
+		return nil, false
+	}
+
+	return value, true
+}
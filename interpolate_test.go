@@ -0,0 +1,159 @@
+package jsnx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("JSNX_TEST_HOME", "/home/x")
+
+	holder, err := NewJsonHolder(`{
+		"host": "example.com",
+		"port": 8080,
+		"empty": "",
+		"tls": {"enabled": true},
+		"url": "http://${/host}:${/port}/",
+		"addr": "${/url}api",
+		"portRef": "${/port}",
+		"tlsRef": "${/tls}",
+		"home": "${JSNX_TEST_HOME}/data",
+		"envHome": "${env:JSNX_TEST_HOME}",
+		"fallback": "${/missing:-none}",
+		"emptyFallback": "${/empty:-${/host}}",
+		"envFallback": "${JSNX_TEST_MISSING:-${/port}}",
+		"escaped": "$${/host} is ${/host}",
+		"unclosed": "${/host",
+		"list": ["${/host}", "${/port}"]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, unresolved, err := holder.Interpolate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unresolved) != 0 {
+		t.Errorf("unresolved %v", unresolved)
+	}
+
+	tests := []struct {
+		path string
+		want Node
+	}{
+		{"/url", "http://example.com:8080/"},
+		{"/addr", "http://example.com:8080/api"},
+		{"/portRef", 8080.0},
+		{"/tlsRef", MapNode{"enabled": true}},
+		{"/home", "/home/x/data"},
+		{"/envHome", "/home/x"},
+		{"/fallback", "none"},
+		{"/emptyFallback", "example.com"},
+		{"/envFallback", 8080.0},
+		{"/escaped", "${/host} is example.com"},
+		{"/unclosed", "${/host"},
+		{"/list", ArryNode{"example.com", 8080.0}},
+	}
+	for _, tt := range tests {
+		got, err := result.Get(tt.path)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, %v, want %#v", tt.path, got, err, tt.want)
+		}
+	}
+
+	//不写回时原holder 不变
+	if url, _ := holder.GetString("/url"); url != "http://${/host}:${/port}/" {
+		t.Errorf("original changed: %q", url)
+	}
+}
+
+// 循环引用及不存在的引用保留原文并报告; 引用循环引用结点的结点也不解析(与解析顺序无关)
+func TestInterpolateUnresolved(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		holder, _ := NewJsonHolder(`{
+			"a": "${/b}",
+			"b": "x${/a}",
+			"c": "use ${/a}",
+			"self": "${/self}",
+			"missing": "${/nothing}",
+			"env": "${JSNX_TEST_MISSING}",
+			"ok": "${/d}",
+			"d": 1
+		}`)
+
+		result, unresolved, err := holder.Interpolate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for path, want := range map[string]string{
+			"/a":       "${/b}",
+			"/b":       "x${/a}",
+			"/c":       "use ${/a}",
+			"/self":    "${/self}",
+			"/missing": "${/nothing}",
+			"/env":     "${JSNX_TEST_MISSING}",
+		} {
+			if got, _ := result.GetString(path); got != want {
+				t.Errorf("%s = %q, want %q", path, got, want)
+			}
+		}
+		if d, _ := result.Get("/ok"); d != 1.0 {
+			t.Errorf("/ok = %#v", d)
+		}
+
+		want := []UnresolvedRef{
+			{Path: "/a", Ref: "/b", Reason: "cycle"},
+			{Path: "/b", Ref: "/a", Reason: "cycle"},
+			{Path: "/c", Ref: "/a", Reason: "cycle"},
+			{Path: "/env", Ref: "JSNX_TEST_MISSING", Reason: "not found"},
+			{Path: "/missing", Ref: "/nothing", Reason: "not found"},
+			{Path: "/self", Ref: "/self", Reason: "cycle"},
+		}
+		if !reflect.DeepEqual(unresolved, want) {
+			t.Fatalf("unresolved %v, want %v", unresolved, want)
+		}
+	}
+}
+
+func TestInterpolateInPlace(t *testing.T) {
+	holder, _ := NewJsonHolder(`{"host":"h","url":"${/host}/x","bad":"${/none}"}`)
+
+	result, unresolved, err := holder.Interpolate(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != holder {
+		t.Error("inPlace returned a new holder")
+	}
+	if url, _ := holder.GetString("/url"); url != "h/x" {
+		t.Errorf("url = %q", url)
+	}
+	if len(unresolved) != 1 || unresolved[0].Path != "/bad" {
+		t.Errorf("unresolved %v", unresolved)
+	}
+}
+
+func TestGetStringExpanded(t *testing.T) {
+	holder, _ := NewJsonHolder(`{"host":"h","url":"${/host}/x","bad":"${/none}","port":"${/n}","n":1}`)
+
+	if url, err := holder.GetStringExpanded("/url"); err != nil || url != "h/x" {
+		t.Errorf("url = %q, %v", url, err)
+	}
+	if _, err := holder.GetStringExpanded("/bad"); err == nil {
+		t.Error("unresolved reference accepted")
+	}
+	if _, err := holder.GetStringExpanded("/missing"); err == nil {
+		t.Error("missing path accepted")
+	}
+	//整个字符串为一个引用时按GetString 转换
+	if port, err := holder.GetStringExpanded("/port"); err != nil || port != "1" {
+		t.Errorf("port = %q, %v", port, err)
+	}
+
+	//不修改holder
+	if url, _ := holder.GetString("/url"); url != "${/host}/x" {
+		t.Errorf("holder changed: %q", url)
+	}
+}
@@ -0,0 +1,363 @@
+package jsnx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 对象遍历顺序
+const (
+	OrderUnordered = 0 //不排序(map 遍历顺序)
+	OrderSorted    = 1 //按键值排序
+	OrderInsertion = 2 //按插入顺序(需先调用KeepKeyOrder), 未记录的键值按排序追加在后面
+)
+
+// 开启键值顺序记录: 之后Parse/ParseFile 解析的对象按文档顺序记录,
+// SetJson 等新增的键值追加在后面, 供IterMap 按插入顺序遍历
+func (holder *JsonHolder) KeepKeyOrder() {
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+
+	if holder.keyOrder == nil {
+		holder.keyOrder = make(map[uintptr]*mapOrder)
+	}
+}
+
+// 对象的键值顺序; 记录中保留对象的引用, 记录期间对象的地址不会被新对象重用
+type mapOrder struct {
+	node MapNode
+	keys []string
+}
+
+// 对象记录的键值顺序(持有锁)
+func (holder *JsonHolder) orderKeys(mapNode MapNode) []string {
+	if order, ok := holder.keyOrder[nodeId(mapNode)]; ok {
+		return order.keys
+	}
+
+	return nil
+}
+
+// 清理不再使用的对象的键值顺序(持有写锁): 记录数超过上次清理后的两倍时,
+// 只保留当前数据及修改历史中的对象
+func (holder *JsonHolder) trimKeyOrder() {
+	if holder.keyOrder == nil || len(holder.keyOrder) <= holder.orderLimit {
+		return
+	}
+
+	used := make(map[uintptr]bool)
+	var mark func(node Node)
+	mark = func(node Node) {
+		switch n := node.(type) {
+		case MapNode:
+			if id := nodeId(n); !used[id] {
+				used[id] = true
+				for _, value := range n {
+					mark(value)
+				}
+			}
+		case ArryNode:
+			for _, value := range n {
+				mark(value)
+			}
+		case ArryMapNode:
+			for _, value := range n {
+				mark(value)
+			}
+		}
+	}
+
+	mark(holder.Data)
+	if h := holder.history; h != nil {
+		items := append(append([]*histItem{h.group}, h.undo...), h.redo...)
+		for _, item := range items {
+			if item != nil {
+				mark(item.before)
+				mark(item.after)
+			}
+		}
+	}
+
+	for id := range holder.keyOrder {
+		if !used[id] {
+			delete(holder.keyOrder, id)
+		}
+	}
+	holder.orderLimit = 2*len(holder.keyOrder) + 64
+}
+
+// 重新记录键值顺序(持有写锁), data 为解析的JSON文本
+func (holder *JsonHolder) resetKeyOrder(data []byte) {
+	if holder.keyOrder == nil {
+		return
+	}
+
+	holder.keyOrder = make(map[uintptr]*mapOrder)
+	holder.orderLimit = 0
+	if len(data) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		holder.scanKeyOrder(dec, holder.Data)
+	}
+}
+
+// 按文档顺序读取token, 与解析后的结点一一对应记录键值顺序
+func (holder *JsonHolder) scanKeyOrder(dec *json.Decoder, node interface{}) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		mapNode, _ := node.(MapNode)
+		keys := make([]string, 0, len(mapNode))
+		for dec.More() {
+			tok, err = dec.Token()
+			if err != nil {
+				return err
+			}
+
+			key, _ := tok.(string)
+			keys = appendKey(keys, key)
+			err = holder.scanKeyOrder(dec, mapNode[key])
+			if err != nil {
+				return err
+			}
+		}
+
+		if mapNode != nil {
+			holder.keyOrder[nodeId(mapNode)] = &mapOrder{node: mapNode, keys: keys}
+		}
+	case json.Delim('['):
+		arryNode, _ := node.(ArryNode)
+		for i := 0; dec.More(); i++ {
+			var child interface{}
+			if i < len(arryNode) {
+				child = arryNode[i]
+			}
+
+			err = holder.scanKeyOrder(dec, child)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+
+	//结束符
+	_, err = dec.Token()
+	return err
+}
+
+// 记录路径上新增的对象键值(持有写锁)
+func (holder *JsonHolder) trackKeys(path string) {
+	newPath := strings.Trim(path, "/")
+	if newPath == "" {
+		return
+	}
+
+	node := holder.Data
+	for _, key := range strings.Split(newPath, "/") {
+		idx := arryIndex(key)
+
+		switch n := node.(type) {
+		case MapNode:
+			if idx >= 0 {
+				return
+			}
+			key = strings.Trim(key, "\"")
+			order, ok := holder.keyOrder[nodeId(n)]
+			if !ok {
+				order = &mapOrder{node: n}
+				holder.keyOrder[nodeId(n)] = order
+			}
+			order.keys = appendKey(order.keys, key)
+			node = n[key]
+		case ArryNode:
+			if idx < 0 || idx >= len(n) {
+				return
+			}
+			node = n[idx]
+		default:
+			return
+		}
+	}
+}
+
+func appendKey(keys []string, key string) []string {
+	for _, k := range keys {
+		if k == key {
+			return keys
+		}
+	}
+
+	return append(keys, key)
+}
+
+// 按指定顺序返回对象的键值(持有锁)
+func (holder *JsonHolder) mapKeys(mapNode MapNode, order int) []string {
+	keys := make([]string, 0, len(mapNode))
+
+	switch order {
+	case OrderSorted:
+		for key := range mapNode {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	case OrderInsertion:
+		listed := make(map[string]bool, len(mapNode))
+		for _, key := range holder.orderKeys(mapNode) {
+			if _, exist := mapNode[key]; exist && !listed[key] {
+				listed[key] = true
+				keys = append(keys, key)
+			}
+		}
+
+		rest := make([]string, 0)
+		for key := range mapNode {
+			if !listed[key] {
+				rest = append(rest, key)
+			}
+		}
+		sort.Strings(rest)
+		keys = append(keys, rest...)
+	default:
+		for key := range mapNode {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// 一次读取对象的键值及内容, 遍历时不持有锁
+func (holder *JsonHolder) mapItems(path string, order int) ([]string, []interface{}, error) {
+	holder.mu.RLock()
+	defer holder.mu.RUnlock()
+
+	node, err := holder.get(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mapNode, ok := node.(MapNode)
+	if !ok {
+		return nil, nil, fmt.Errorf("Node[%s] not object", path)
+	}
+
+	keys := holder.mapKeys(mapNode, order)
+	nodes := make([]interface{}, len(keys))
+	for i, key := range keys {
+		nodes[i] = mapNode[key]
+	}
+
+	return keys, nodes, nil
+}
+
+// 遍历对象结点, order 为 OrderUnordered, OrderSorted 或 OrderInsertion
+func (holder *JsonHolder) IterMap(path string, order int, fn func(key string, node interface{}) error) error {
+	keys, nodes, err := holder.mapItems(path, order)
+	if err != nil {
+		return err
+	}
+
+	for i, key := range keys {
+		err = fn(key, nodes[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 遍历对象结点
+func (holder *JsonHolder) IterMapHolder(path string, order int, fn func(key string, nHolder *JsonHolder) error) error {
+	keys, nodes, err := holder.mapItems(path, order)
+	if err != nil {
+		return err
+	}
+
+	for i, key := range keys {
+		err = fn(key, Holder(nodes[i]))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func IterMap(data interface{}, path string, order int, fn func(key string, node interface{}) error) error {
+	jsx := &JsonHolder{Data: data}
+	return jsx.IterMap(path, order, fn)
+}
+
+func IterMapHolder(data interface{}, path string, order int, fn func(key string, nHolder *JsonHolder) error) error {
+	jsx := &JsonHolder{Data: data}
+	return jsx.IterMapHolder(path, order, fn)
+}
+
+// 按记录的键值顺序格式化结点(持有锁), 没有记录顺序的对象按键值排序(同FormatJson)
+func (holder *JsonHolder) formatOrdered(node Node, formatter string) (string, error) {
+	buff := bytes.Buffer{}
+	if err := holder.encodeOrdered(&buff, node); err != nil {
+		return "", err
+	}
+
+	if formatter == "" {
+		return buff.String(), nil
+	}
+
+	out := bytes.Buffer{}
+	if err := json.Indent(&out, buff.Bytes(), "", formatter); err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+func (holder *JsonHolder) encodeOrdered(buff *bytes.Buffer, node Node) error {
+	if mapNode, ok := node.(MapNode); ok && mapNode != nil {
+		buff.WriteByte('{')
+		for i, key := range holder.mapKeys(mapNode, OrderInsertion) {
+			if i > 0 {
+				buff.WriteByte(',')
+			}
+			data, _ := json.Marshal(key)
+			buff.Write(data)
+			buff.WriteByte(':')
+			if err := holder.encodeOrdered(buff, mapNode[key]); err != nil {
+				return err
+			}
+		}
+		buff.WriteByte('}')
+		return nil
+	}
+
+	if items, ok := asArry(node); ok && items != nil {
+		buff.WriteByte('[')
+		for i, item := range items {
+			if i > 0 {
+				buff.WriteByte(',')
+			}
+			if err := holder.encodeOrdered(buff, item); err != nil {
+				return err
+			}
+		}
+		buff.WriteByte(']')
+		return nil
+	}
+
+	data, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+
+	buff.Write(data)
+	return nil
+}
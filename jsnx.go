@@ -21,6 +21,23 @@ type ArryMapNode = []map[string]interface{}
 type JsonHolder struct {
 	Data interface{} //可取范围为 map[string]interface{}, []map[string]interface{}
 	mu   sync.RWMutex
+
+	wmu      sync.Mutex //订阅者锁
+	watchers []*watcher //变更订阅者
+	watchSeq int
+
+	shared bool                 //数据被快照共享, 修改时写时复制
+	owned  map[uintptr]struct{} //共享后已复制的结点
+	views  int32                //进行中的只读视图(Walk 等), 期间的修改写时复制
+
+	history *history //修改历史(撤消/重做)
+	oplog   *OpLog   //操作日志
+	actor   string   //当前写操作的操作者(UpdateAs)
+
+	bindings []*binding //绑定的存储(Bind)
+
+	keyOrder   map[uintptr]*mapOrder //对象键值的插入顺序, 为nil 时不记录
+	orderLimit int                   //键值顺序记录数超过时清理不再使用的对象
 }
 
 func NewJsonHolder(data interface{}) (*JsonHolder, error) {
@@ -59,9 +76,16 @@ func (np *NodePos) Set(pns *ArryNode, pmn *MapNode, idx int, key string) {
 // 清空JSON对象
 func (holder *JsonHolder) Clear() {
 	holder.mu.Lock()
-	defer holder.mu.Unlock()
-
+	oldData := holder.beginWrite()
 	holder.Data = nil
+	holder.resetKeyOrder(nil)
+	ev := ChangeEvent{Path: "/", Op: OpClear, OldValue: oldData}
+	err := holder.endWrite(oldData, OpClear, ev)
+	holder.mu.Unlock()
+
+	if err == nil {
+		holder.notify(ev)
+	}
 }
 
 // 解析字符串
@@ -93,7 +117,8 @@ func ParseFile(filePath string) (*JsonHolder, error) {
 	return holder, nil
 }
 
-// 解析对象
+// 解析对象: string/[]byte 按JSON 解析; 其它值直接保存, 其中的ArryMapNode 转换为ArryNode
+// (只复制包含ArryMapNode 的容器, 传入的容器本身不被替换), 其余结点(包括数组中的map)与调用方共享
 func (holder *JsonHolder) Parse(data interface{}) error {
 	var (
 		err       error
@@ -102,24 +127,34 @@ func (holder *JsonHolder) Parse(data interface{}) error {
 		ok        bool
 	)
 	holder.mu.Lock()
-	defer holder.mu.Unlock()
+	oldData := holder.beginWrite()
 
 	if jsonStr, ok = data.(string); ok {
-		err = json.Unmarshal([]byte(jsonStr), &(holder.Data))
+		jsonBytes = []byte(jsonStr)
+		err = json.Unmarshal(jsonBytes, &(holder.Data))
 	} else if jsonBytes, ok = data.([]byte); ok {
 		err = json.Unmarshal(jsonBytes, &(holder.Data))
 	} else {
-		holder.Data = data
+		holder.Data, _ = storeNode(data)
+	}
+
+	ev := ChangeEvent{Path: "/", Op: OpParse, OldValue: oldData, NewValue: holder.Data}
+	if err == nil {
+		holder.resetKeyOrder(jsonBytes)
+		err = holder.endWrite(oldData, OpParse, ev)
 	}
+	holder.mu.Unlock()
 
-	return err
+	if err != nil {
+		return err
+	}
+
+	holder.notify(ev)
+	return nil
 }
 
 // 解析文件
 func (holder *JsonHolder) ParseFile(filePath string) error {
-	holder.mu.Lock()
-	defer holder.mu.Unlock()
-
 	file, err := os.Open(filePath)
 	if err != nil {
 		return err
@@ -131,14 +166,39 @@ func (holder *JsonHolder) ParseFile(filePath string) error {
 		return err
 	}
 
-	err = json.Unmarshal(data, &holder.Data)
+	var newData interface{}
+	err = json.Unmarshal(data, &newData)
+	if err != nil {
+		return err
+	}
+
+	holder.mu.Lock()
+	oldData := holder.beginWrite()
+	holder.Data = newData
+	holder.resetKeyOrder(data)
+	ev := ChangeEvent{Path: "/", Op: OpParse, OldValue: oldData, NewValue: newData}
+	err = holder.endWrite(oldData, OpParse, ev)
+	holder.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
 
-	return err
+	holder.notify(ev)
+	return nil
 }
 
 // 获取指定路径的数组长度(正值); 非数组返回负数;
 func (holder *JsonHolder) ArryLen(path string) (int, error) {
-	node, err := holder.Get(path)
+	holder.mu.RLock()
+	defer holder.mu.RUnlock()
+
+	return holder.arryLen(path)
+}
+
+// 获取数组长度(不加锁)
+func (holder *JsonHolder) arryLen(path string) (int, error) {
+	node, err := holder.get(path)
 	if err != nil {
 		return -1, err
 	}
@@ -162,6 +222,27 @@ func (holder *JsonHolder) ArryLen(path string) (int, error) {
 
 // 设置指定结点为JSON对象 /abc/1, 表示取abc 下的数组1内容; /abc/"1", 表示取/abc 下1的值
 func (holder *JsonHolder) SetJson(path string, jsonObj interface{}) error {
+	holder.mu.Lock()
+	oldData := holder.beginWrite()
+	evPath := holder.setPath(path)
+	oldNode, _ := holder.get(evPath)
+	err := holder.setJson(path, jsonObj)
+	ev := ChangeEvent{Path: evPath, Op: OpSet, OldValue: oldNode, NewValue: jsonObj}
+	if err == nil {
+		err = holder.endWrite(oldData, OpSet+" "+evPath, ev)
+	}
+	holder.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	holder.notify(ev)
+	return nil
+}
+
+// 设置结点(不加锁)
+func (holder *JsonHolder) setJson(path string, jsonObj interface{}) error {
 	var (
 		ArryIndex int
 		OkFlag    bool
@@ -169,9 +250,12 @@ func (holder *JsonHolder) SetJson(path string, jsonObj interface{}) error {
 		nPos *NodePos
 	)
 
-	holder.mu.Lock()
-	defer holder.mu.Unlock()
+	if holder.keyOrder != nil {
+		defer holder.trackKeys(path)
+	}
 
+	jsonObj, _ = storeNode(jsonObj)
+	holder.cowPath(path)
 	pathBuff := bytes.Buffer{}
 
 	newPath := strings.Trim(path, "/")
@@ -387,17 +471,117 @@ func (holder *JsonHolder) SetJson(path string, jsonObj interface{}) error {
 	return nil
 }
 
+// 转换要保存的结点: ArryMapNode 转换为ArryNode, 之后查找路径时不需要再逐层转换;
+// 只复制包含ArryMapNode 的容器, 不修改原结点. 返回是否有转换
+func storeNode(node Node) (Node, bool) {
+	switch n := node.(type) {
+	case ArryMapNode:
+		arryNode := make(ArryNode, len(n))
+		for i, value := range n {
+			arryNode[i], _ = storeNode(value)
+		}
+		return arryNode, true
+	case MapNode:
+		var mapNode MapNode
+		for key, value := range n {
+			v, changed := storeNode(value)
+			if !changed {
+				continue
+			}
+			if mapNode == nil {
+				mapNode = make(MapNode, len(n))
+				for k, v := range n {
+					mapNode[k] = v
+				}
+			}
+			mapNode[key] = v
+		}
+		if mapNode != nil {
+			return mapNode, true
+		}
+	case ArryNode:
+		var arryNode ArryNode
+		for i, value := range n {
+			v, changed := storeNode(value)
+			if !changed {
+				continue
+			}
+			if arryNode == nil {
+				arryNode = append(make(ArryNode, 0, len(n)), n...)
+			}
+			arryNode[i] = v
+		}
+		if arryNode != nil {
+			return arryNode, true
+		}
+	}
+
+	return node, false
+}
+
+// 替换已存在的结点(不加锁); 与setJson 不同, 数组元素在原位置替换而不是追加
+func (holder *JsonHolder) replace(path string, node interface{}) error {
+	node, _ = storeNode(node)
+	newPath := strings.Trim(path, "/")
+	if newPath == "" {
+		holder.Data = node
+		return nil
+	}
+
+	holder.cowPath(path)
+
+	keys := strings.Split(newPath, "/")
+	last := len(keys) - 1
+	parent, err := holder.get(strings.Join(keys[:last], "/"))
+	if err != nil {
+		return err
+	}
+
+	idx := arryIndex(keys[last])
+	switch n := parent.(type) {
+	case MapNode:
+		if idx >= 0 {
+			return fmt.Errorf("invalid path(%v)", path)
+		}
+		n[strings.Trim(keys[last], "\"")] = node
+	case ArryNode:
+		if idx < 0 || idx >= len(n) {
+			return fmt.Errorf("Path(%v) Index out of range", path)
+		}
+		n[idx] = node
+	case ArryMapNode:
+		mapNode, ok := node.(MapNode)
+		if idx < 0 || idx >= len(n) || !ok {
+			return fmt.Errorf("invalid path(%v)", path)
+		}
+		n[idx] = mapNode
+	default:
+		return fmt.Errorf("invalid path(%v)", path)
+	}
+
+	if holder.keyOrder != nil {
+		holder.trackKeys(path)
+	}
+
+	return nil
+}
+
 // 获取指定位置的数据
 func (holder *JsonHolder) Get(path string) (Node, error) {
+	holder.mu.RLock()
+	defer holder.mu.RUnlock()
+
+	return holder.get(path)
+}
+
+// 获取指定位置的数据(不加锁)
+func (holder *JsonHolder) get(path string) (Node, error) {
 	var (
 		ArryIndex int      //数组索引位置
 		OkFlag    bool     //数据类型转换标志
 		nPos      *NodePos //结点位置
 	)
 
-	holder.mu.RLock()
-	defer holder.mu.RUnlock()
-
 	pathBuff := bytes.Buffer{}
 
 	newPath := strings.Trim(path, "/")
@@ -434,7 +618,7 @@ func (holder *JsonHolder) Get(path string) (Node, error) {
 			//当前是层是数组
 			var arryNode ArryNode
 			if i == 0 {
-				arryNode, OkFlag = (*nPos.RootNode).(ArryNode)
+				arryNode, OkFlag = asArry(*nPos.RootNode)
 				if !OkFlag {
 					return nil, fmt.Errorf("invalid path(%v)", pathBuff.String())
 				}
@@ -445,7 +629,7 @@ func (holder *JsonHolder) Get(path string) (Node, error) {
 						return nil, fmt.Errorf("convert err(%v)", pathBuff.String())
 					}
 
-					arryNode, OkFlag = ((*nPos.PrevNodes)[nPos.NodeIdx]).(ArryNode)
+					arryNode, OkFlag = asArry((*nPos.PrevNodes)[nPos.NodeIdx])
 					if !OkFlag {
 						return nil, fmt.Errorf("invalid path(%v)", pathBuff.String())
 					}
@@ -457,7 +641,7 @@ func (holder *JsonHolder) Get(path string) (Node, error) {
 						return nil, fmt.Errorf("内部错误2(%v)", pathBuff.String())
 					}
 
-					arryNode, OkFlag = ((*nPos.PrevMapNode)[nPos.NodeKey]).(ArryNode)
+					arryNode, OkFlag = asArry((*nPos.PrevMapNode)[nPos.NodeKey])
 					if !OkFlag {
 						return nil, fmt.Errorf("无效的路径2(%v)", pathBuff.String())
 					}
@@ -590,15 +774,22 @@ func (holder *JsonHolder) GetFloat(path string) (float64, error) {
 		return 0, err
 	}
 
-	if node == nil {
-		return 0, nil
-	}
+	return toFloat(node)
+}
 
+// 转换为浮点数: nil 为0, 字符串按数字解析
+func toFloat(node Node) (float64, error) {
 	switch node.(type) {
+	case nil:
+		return 0, nil
 	case int:
 		return float64(node.(int)), nil
+	case int64:
+		return float64(node.(int64)), nil
 	case float64:
 		return node.(float64), nil
+	case json.Number:
+		return node.(json.Number).Float64()
 	case string:
 		f, err := strconv.ParseFloat(node.(string), 64)
 		if err != nil {
@@ -657,12 +848,59 @@ func (holder *JsonHolder) Exist(path string) bool {
 	return (node != nil)
 }
 
+// 取结点, 同时返回结点是否存在: 与Exist 不同, 值为null 的结点也存在
+func (holder *JsonHolder) Lookup(path string) (Node, bool) {
+	holder.mu.RLock()
+	defer holder.mu.RUnlock()
+
+	return holder.lookup(path)
+}
+
+// 取结点(不加锁), 同时返回结点是否存在: 与Exist 不同, 值为null 的结点也存在
+func (holder *JsonHolder) lookup(path string) (Node, bool) {
+	node, err := holder.get(path)
+	if err != nil {
+		return nil, false
+	}
+
+	newPath := strings.Trim(path, "/")
+	if node != nil || newPath == "" {
+		return node, true
+	}
+
+	keys := strings.Split(newPath, "/")
+	last := len(keys) - 1
+	parent, err := holder.get(strings.Join(keys[:last], "/"))
+	if err != nil {
+		return nil, false
+	}
+
+	idx := arryIndex(keys[last])
+	switch n := parent.(type) {
+	case MapNode:
+		_, exist := n[strings.Trim(keys[last], "\"")]
+		return nil, exist && idx < 0
+	case ArryNode:
+		return nil, idx >= 0 && idx < len(n)
+	}
+
+	return nil, false
+}
+
 // 获取指定位置的Key的数据
 func (holder *JsonHolder) Keys(path string, isDeepArry bool) ([]string, error) {
+	holder.mu.RLock()
+	defer holder.mu.RUnlock()
+
+	return holder.keys(path, isDeepArry)
+}
+
+// 获取Key(不加锁)
+func (holder *JsonHolder) keys(path string, isDeepArry bool) ([]string, error) {
 	deepLevel := 0
 	keys := make([]string, 0)
 
-	jsxNode, err := holder.Get(path)
+	jsxNode, err := holder.get(path)
 	if err != nil {
 		return nil, err
 	}
@@ -717,16 +955,38 @@ func (holder *JsonHolder) Keys(path string, isDeepArry bool) ([]string, error) {
 	}
 }
 
+// 删除指定路径结点
 func (holder *JsonHolder) Del(path string) error {
+	holder.mu.Lock()
+	oldData := holder.beginWrite()
+	oldNode, _ := holder.get(path)
+	err := holder.del(path)
+	var events []ChangeEvent
+	if cleanPath(path) != "/" {
+		events = append(events, ChangeEvent{Path: cleanPath(path), Op: OpDel, OldValue: oldNode})
+	}
+	if err == nil {
+		err = holder.endWrite(oldData, OpDel+" "+cleanPath(path), events...)
+	}
+	holder.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	holder.notify(events...)
+	return nil
+}
+
+// 删除指定路径结点(不加锁)
+func (holder *JsonHolder) del(path string) error {
 	var (
 		ArryIndex int      //数组索引位置
 		OkFlag    bool     //数据类型转换标志
 		nPos      *NodePos //结点位置
 	)
 
-	holder.mu.Lock()
-	defer holder.mu.Unlock()
-
+	holder.cowPath(path)
 	pathBuff := bytes.Buffer{}
 
 	newPath := strings.Trim(path, "/")
@@ -952,16 +1212,26 @@ func (holder *JsonHolder) Del(path string) error {
 
 // 删除指定路径结点，并返回结点内容
 func (holder *JsonHolder) Remove(path string) (interface{}, error) {
-	node, err := holder.Get(path)
-	if err != nil {
-		return nil, err
+	holder.mu.Lock()
+	oldData := holder.beginWrite()
+	node, err := holder.get(path)
+	if err == nil {
+		err = holder.del(path)
 	}
+	var events []ChangeEvent
+	if cleanPath(path) != "/" {
+		events = append(events, ChangeEvent{Path: cleanPath(path), Op: OpRemove, OldValue: node})
+	}
+	if err == nil {
+		err = holder.endWrite(oldData, OpRemove+" "+cleanPath(path), events...)
+	}
+	holder.mu.Unlock()
 
-	err = holder.Del(path)
 	if err != nil {
 		return nil, err
 	}
 
+	holder.notify(events...)
 	return node, nil
 }
 
@@ -970,25 +1240,16 @@ func (holder *JsonHolder) String(path, formatter string) (string, error) {
 	holder.mu.RLock()
 	defer holder.mu.RUnlock()
 
-	var holder2 *JsonHolder
-	var jsonStr string
-	var err error
-
-	if path == "" {
-		holder2 = holder
-	} else {
-		holder2, err = holder.GetJson(path)
-		if err != nil {
-			return "", err
-		}
-	}
-
-	jsonStr, err = FormatJson(holder2.Data, formatter)
+	node, err := holder.get(path)
 	if err != nil {
 		return "", err
 	}
 
-	return jsonStr, nil
+	if holder.keyOrder != nil {
+		return holder.formatOrdered(node, formatter)
+	}
+
+	return FormatJson(node, formatter)
 }
 
 // 格式化
@@ -1012,12 +1273,16 @@ func FormatJson(v interface{}, formatter string) (string, error) {
 // 深度复制数据
 func CopyFrom(srcHolder *JsonHolder, path string) (*JsonHolder, error) {
 	var newNode Node
-	node, err := srcHolder.Get(path)
+
+	srcHolder.mu.RLock()
+	node, err := srcHolder.get(path)
 	if err != nil {
+		srcHolder.mu.RUnlock()
 		return nil, err
 	}
 
 	data, err := json.Marshal(node)
+	srcHolder.mu.RUnlock()
 	if err != nil {
 		return nil, err
 	}
@@ -1066,9 +1331,14 @@ func (holder *JsonHolder) CopyNodes(path string, fromJsx *JsonHolder, fromPaths
 		isShortFlag = isLastName[0]
 	}
 
+	//先读取源结点, 再一次写入(源与目标为同一holder 时也不会重复加锁)
 	fromNames := strings.Split(fromPaths, ",")
+	names := make([]string, 0, len(fromNames))
+	nodes := make([]interface{}, 0, len(fromNames))
+
+	fromJsx.mu.RLock()
 	for _, name := range fromNames {
-		node, err := fromJsx.Get(name)
+		node, err := fromJsx.get(name)
 		if err != nil {
 			continue
 		}
@@ -1080,38 +1350,41 @@ func (holder *JsonHolder) CopyNodes(path string, fromJsx *JsonHolder, fromPaths
 			}
 		}
 
-		holder.SetJson(path+"/"+strings.TrimLeft(name, "/"), node)
+		names = append(names, path+"/"+strings.TrimLeft(name, "/"))
+		nodes = append(nodes, node)
 	}
+	fromJsx.mu.RUnlock()
 
+	events := make([]ChangeEvent, 0, len(names))
+
+	holder.mu.Lock()
+	oldData := holder.beginWrite()
+	for i, name := range names {
+		evPath := holder.setPath(name)
+		oldNode, _ := holder.get(evPath)
+		if err := holder.setJson(name, nodes[i]); err != nil {
+			continue
+		}
+
+		events = append(events, ChangeEvent{Path: evPath, Op: OpSet, OldValue: oldNode, NewValue: nodes[i]})
+	}
+	if len(events) > 0 && holder.endWrite(oldData, "copy "+path, events...) != nil {
+		events = nil
+	}
+	holder.mu.Unlock()
+
+	holder.notify(events...)
 	return
 }
 
 // 遍历数组节点
 func (holder *JsonHolder) Iter(path string, fn func(i int, node interface{}) error) error {
-	var (
-		path2 string
-	)
-	nums, err := holder.ArryLen(path)
+	items, err := holder.arryItems(path)
 	if err != nil {
 		return err
 	}
 
-	if nums < 0 {
-		return fmt.Errorf("Node[%s] not array", path)
-	}
-
-	for i := 0; i < nums; i++ {
-		path2 = strconv.Itoa(i)
-		if path != "" {
-			path2 = path + "/" + path2
-			path2 = strings.ReplaceAll(path2, "//", "/") //替换掉路径中//
-		}
-
-		node, err := holder.Get(path2)
-		if err != nil {
-			return err
-		}
-
+	for i, node := range items {
 		err = fn(i, node)
 		if err != nil {
 			return err
@@ -1123,30 +1396,12 @@ func (holder *JsonHolder) Iter(path string, fn func(i int, node interface{}) err
 
 // 遍历数组节点
 func (holder *JsonHolder) IterHolder(path string, fn func(i int, nHolder *JsonHolder) error) error {
-	var (
-		path2 string
-	)
-	nums, err := holder.ArryLen(path)
+	items, err := holder.arryItems(path)
 	if err != nil {
 		return err
 	}
 
-	if nums < 0 {
-		return fmt.Errorf("Node[%s] not array", path)
-	}
-
-	for i := 0; i < nums; i++ {
-		path2 = strconv.Itoa(i)
-		if path != "" {
-			path2 = path + "/" + path2
-			path2 = strings.ReplaceAll(path2, "//", "/") //替换掉路径中//
-		}
-
-		node, err := holder.Get(path2)
-		if err != nil {
-			return err
-		}
-
+	for i, node := range items {
 		err = fn(i, Holder(node))
 		if err != nil {
 			return err
@@ -1156,6 +1411,42 @@ func (holder *JsonHolder) IterHolder(path string, fn func(i int, nHolder *JsonHo
 	return nil
 }
 
+// 一次读取数组的全部元素(复制), 遍历时不持有锁, 回调中可以读写holder
+func (holder *JsonHolder) arryItems(path string) (ArryNode, error) {
+	_, items, err := holder.readArry(path)
+	return items, err
+}
+
+// 读取数组结点及其全部元素(复制); inPlace=true 时冻结数据, 之后的修改不再改变读取的结点,
+// 写回前可以比较数组是否被修改
+func (holder *JsonHolder) readArry(path string, inPlace ...bool) (Node, ArryNode, error) {
+	if len(inPlace) > 0 && inPlace[0] {
+		holder.mu.Lock()
+		defer holder.mu.Unlock()
+		holder.freeze()
+	} else {
+		holder.mu.RLock()
+		defer holder.mu.RUnlock()
+	}
+
+	nums, err := holder.arryLen(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if nums < 0 {
+		return nil, nil, fmt.Errorf("Node[%s] not array", path)
+	}
+
+	node, _ := holder.get(path)
+	if arryNode, ok := node.(ArryNode); ok {
+		return node, append(make(ArryNode, 0, len(arryNode)), arryNode...), nil
+	}
+
+	items, _ := asArry(node)
+	return node, items, nil
+}
+
 // 包装JSON数据
 func Holder(data interface{}) *JsonHolder {
 	return &JsonHolder{Data: data}
@@ -0,0 +1,156 @@
+package jsnx
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 多个goroutine 同时读写同一个holder, 需要配合 -race 运行
+func TestConcurrentAccess(t *testing.T) {
+	holder, err := NewJsonHolder(`{"items":[1,2,3],"src":{"a":1,"b":2},"dst":{}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		workers = 8
+		rounds  = 200
+	)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(5)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				if err := holder.SetJson(fmt.Sprintf("/w%d/%d", w, i%10), i); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				holder.Remove(fmt.Sprintf("/w%d/%d", w, i%10))
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				if _, err := holder.String("/", ""); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				holder.CopyNodes(fmt.Sprintf("/dst/%d", w), holder, "/src/a,/src/b")
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				err := holder.Iter("/items", func(i int, node interface{}) error {
+					return nil
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("deadlock: concurrent operations did not finish")
+	}
+
+	for w := 0; w < workers; w++ {
+		path := fmt.Sprintf("/dst/%d", w)
+		if a, err := holder.GetInt(path + "/a"); err != nil || a != 1 {
+			t.Errorf("%s/a = %v, %v", path, a, err)
+		}
+	}
+}
+
+// Remove 读取及删除在同一次加锁内完成: 同一结点只有一个goroutine 能取到
+func TestConcurrentRemove(t *testing.T) {
+	holder, _ := NewJsonHolder(`{"token":"x"}`)
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		taken int
+	)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			node, err := holder.Remove("/token")
+			if err == nil && node != nil {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if taken != 1 {
+		t.Errorf("token removed %d times, want 1", taken)
+	}
+}
+
+// Parse 非JSON 文本的值: ArryMapNode 转换为ArryNode, 传入的值不变
+func TestParseNode(t *testing.T) {
+	items := ArryMapNode{{"id": 1.0}, {"id": 2.0}}
+	data := MapNode{"items": items, "name": "a"}
+
+	holder := &JsonHolder{}
+	if err := holder.Parse(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if node, _ := holder.Get("/items"); !isArryNode(node) {
+		t.Errorf("/items stored as %T", node)
+	}
+	if _, ok := data["items"].(ArryMapNode); !ok {
+		t.Errorf("caller's value changed to %T", data["items"])
+	}
+
+	if err := holder.SetJson("/items/0/id", 3); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := holder.GetInt("/items/0/id"); id != 3 {
+		t.Errorf("id %d", id)
+	}
+	if _, ok := data["items"].(ArryMapNode); !ok || len(items) != 2 {
+		t.Errorf("caller's array changed: %v", data["items"])
+	}
+
+	//不含ArryMapNode 时直接保存
+	plain := MapNode{"a": ArryNode{1.0}}
+	holder.Parse(plain)
+	plain["b"] = true
+	if !holder.Exist("/b") {
+		t.Error("plain node copied on Parse")
+	}
+}
+
+func isArryNode(node Node) bool {
+	_, ok := node.(ArryNode)
+	return ok
+}
@@ -0,0 +1,367 @@
+package jsnx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 日志中的快照记录
+const OpSnapshot = "snapshot"
+
+// 操作日志中的一条记录
+type LogEntry struct {
+	Seq   int64       `json:"seq,omitempty"`
+	Tx    int64       `json:"tx,omitempty"` //一次写操作有多条记录时为其中最后一条的序号, 读取时忽略不完整的写操作
+	Time  time.Time   `json:"time"`
+	Actor string      `json:"actor,omitempty"`
+	Op    string      `json:"op"` //snapshot 或变更操作类型
+	Path  string      `json:"path,omitempty"`
+	Value interface{} `json:"value,omitempty"` //快照数据或变更后的值
+}
+
+// 预写操作日志: holder 的每次修改在释放写锁之前追加到日志, 写日志失败时修改被撤消
+type OpLog struct {
+	Path  string
+	Actor string //默认操作者, UpdateAs 可以指定
+
+	mu      sync.Mutex
+	file    *os.File
+	seq     int64 //最后一条记录的序号
+	entries int   //最后一个快照之后的记录数
+}
+
+// 打开(不存在时创建)操作日志; 写入时中断留下的不完整内容被截掉
+func OpenOpLog(path string) (*OpLog, error) {
+	l := &OpLog{Path: path}
+
+	end, err := readLogFile(path, func(entry LogEntry) error {
+		l.seq = entry.Seq
+		if entry.Op == OpSnapshot {
+			l.entries = 0
+		} else {
+			l.entries++
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	l.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	//从最后一条完整记录之后追加
+	info, err := l.file.Stat()
+	if err == nil && info.Size() > end {
+		err = l.file.Truncate(end)
+	}
+	if err != nil {
+		l.file.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// 关闭日志文件
+func (l *OpLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// 最后一条记录的序号
+func (l *OpLog) Seq() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.seq
+}
+
+// 最后一个快照之后的记录数
+func (l *OpLog) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.entries
+}
+
+// 追加变更记录, 写入后同步到磁盘; 多条记录作为一个事务, 读取时只有全部写入才生效
+func (l *OpLog) append(actor string, events []ChangeEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return fmt.Errorf("oplog %s closed", l.Path)
+	}
+	if actor == "" {
+		actor = l.Actor
+	}
+
+	var tx int64
+	if len(events) > 1 {
+		tx = l.seq + int64(len(events))
+	}
+
+	buff := bytes.Buffer{}
+	seq, now := l.seq, time.Now()
+	for _, ev := range events {
+		seq++
+		line, err := json.Marshal(LogEntry{Seq: seq, Tx: tx, Time: now, Actor: actor, Op: ev.Op, Path: ev.Path, Value: ev.NewValue})
+		if err != nil {
+			return err
+		}
+		buff.Write(line)
+		buff.WriteByte('\n')
+	}
+
+	if _, err := l.file.Write(buff.Bytes()); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+
+	l.seq = seq
+	l.entries += len(events)
+	return nil
+}
+
+// 压缩: 用只有一个快照记录的新日志替换原日志, 序号继续递增
+func (l *OpLog) compact(data interface{}) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return fmt.Errorf("oplog %s closed", l.Path)
+	}
+
+	line, err := json.Marshal(LogEntry{Seq: l.seq + 1, Time: time.Now(), Actor: l.Actor, Op: OpSnapshot, Value: data})
+	if err != nil {
+		return err
+	}
+
+	if err = writeFileAtomic(l.Path, append(line, '\n')); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(l.Path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	l.file.Close()
+	l.file = file
+
+	l.seq++
+	l.entries = 0
+	return nil
+}
+
+// 逐条读取日志, 返回最后一条完整记录之后的位置; 最后一行不完整(写入时中断)时忽略,
+// 事务的记录全部读到后才交给fn, 不完整的事务忽略
+func readLog(r io.Reader, name string, fn func(entry LogEntry) error) (int64, error) {
+	var (
+		offset, end int64
+		pending     []LogEntry //未读完的事务
+	)
+
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return end, err
+		}
+		if err == io.EOF {
+			return end, nil
+		}
+		offset += int64(len(data))
+
+		if len(bytes.TrimSpace(data)) == 0 {
+			if len(pending) == 0 {
+				end = offset
+			}
+			continue
+		}
+
+		var entry LogEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return end, fmt.Errorf("%s line %d: %v", name, line, err)
+		}
+
+		if len(pending) > 0 && pending[0].Tx != entry.Tx {
+			pending = nil //之前的事务没有写完
+		}
+		pending = append(pending, entry)
+		if entry.Tx != 0 && entry.Seq != entry.Tx {
+			continue
+		}
+
+		for _, entry := range pending {
+			if err := fn(entry); err != nil {
+				return end, fmt.Errorf("%s line %d: %v", name, line, err)
+			}
+		}
+		pending = nil
+		end = offset
+	}
+}
+
+func readLogFile(path string, fn func(entry LogEntry) error) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return readLog(file, path, fn)
+}
+
+// 读取日志的全部记录
+func ReadOpLog(path string) ([]LogEntry, error) {
+	entries := make([]LogEntry, 0)
+
+	_, err := readLogFile(path, func(entry LogEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// 从日志中最近的快照开始重放, 重建holder; 指定untilSeq 时只重放到该序号(含),
+// 结束于该序号之后的事务不重放
+func ReplayOpLog(path string, untilSeq ...int64) (*JsonHolder, error) {
+	var entries []LogEntry
+
+	_, err := readLogFile(path, func(entry LogEntry) error {
+		if len(untilSeq) > 0 && (entry.Seq > untilSeq[0] || entry.Tx > untilSeq[0]) {
+			return nil
+		}
+		if entry.Op == OpSnapshot {
+			entries = entries[:0]
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	holder := NewEmptyHolder()
+	if err = holder.Replay(entries...); err != nil {
+		return nil, err
+	}
+
+	return holder, nil
+}
+
+// 在当前数据上重放日志记录(快照记录替换全部数据)
+func (holder *JsonHolder) Replay(entries ...LogEntry) error {
+	holder.mu.Lock()
+	oldData := holder.beginWrite()
+	holder.freeze() //重放失败时恢复原数据
+
+	var err error
+	for _, entry := range entries {
+		if err = holder.replay(entry.Op, entry.Path, entry.Value); err != nil {
+			err = fmt.Errorf("seq %d: %v", entry.Seq, err)
+			break
+		}
+	}
+
+	ev := ChangeEvent{Path: "/", Op: OpParse, OldValue: oldData, NewValue: holder.Data}
+	if err == nil {
+		err = holder.endWrite(oldData, "replay", ev)
+	} else {
+		holder.Data = oldData
+		holder.owned = nil
+	}
+	holder.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	holder.notify(ev)
+	return nil
+}
+
+// 重放一个变更(不加锁): 快照替换全部数据, 删除操作删除结点,
+// 其它操作将结点设置为变更后的值(结点存在时原位置替换, 否则按setJson 写入)
+func (holder *JsonHolder) replay(op, path string, value interface{}) error {
+	switch op {
+	case OpSnapshot:
+		holder.Data = value
+		return nil
+	case OpDel, OpRemove:
+		if strings.Trim(path, "/") == "" {
+			return nil
+		}
+		return holder.del(path)
+	}
+
+	if _, exist := holder.lookup(path); exist {
+		return holder.replace(path, value)
+	}
+
+	return holder.setJson(path, value)
+}
+
+// 将修改记录到操作日志; 日志为空时先写入当前数据的快照
+func (holder *JsonHolder) AttachLog(l *OpLog) error {
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+
+	if l.Seq() == 0 {
+		if err := l.compact(holder.Data); err != nil {
+			return err
+		}
+	}
+
+	holder.oplog = l
+	return nil
+}
+
+// 停止记录操作日志
+func (holder *JsonHolder) DetachLog() {
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+
+	holder.oplog = nil
+}
+
+// 将当前数据写为操作日志的新快照, 丢弃之前的记录
+func (holder *JsonHolder) CompactLog() error {
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+
+	if holder.oplog == nil {
+		return fmt.Errorf("oplog not attached")
+	}
+
+	return holder.oplog.compact(holder.Data)
+}
+
+// 同Update, 操作日志中记录的操作者为actor
+func (holder *JsonHolder) UpdateAs(actor string, fn func(tx *Tx) error) error {
+	return holder.update(actor, fn)
+}
@@ -0,0 +1,241 @@
+package jsnx
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func openTestLog(t *testing.T, doc string) (*JsonHolder, *OpLog, string) {
+	path := filepath.Join(t.TempDir(), "ops.log")
+
+	holder, err := NewJsonHolder(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := OpenOpLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	if err = holder.AttachLog(l); err != nil {
+		t.Fatal(err)
+	}
+
+	return holder, l, path
+}
+
+func replayEqual(t *testing.T, path string, holder *JsonHolder, untilSeq ...int64) {
+	t.Helper()
+
+	replayed, err := ReplayOpLog(path, untilSeq...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, _ := holder.String("/", "")
+	got, _ := replayed.String("/", "")
+	if got != want {
+		t.Errorf("replayed %s, want %s", got, want)
+	}
+}
+
+func TestOpLogReplay(t *testing.T) {
+	holder, l, path := openTestLog(t, `{"a":1,"list":[1,2]}`)
+
+	holder.SetJson("/b/c", "x")
+	holder.Del("/a")
+	seq := l.Seq()
+	before, _ := holder.String("/", "")
+
+	err := holder.UpdateAs("bob", func(tx *Tx) error {
+		if err := tx.Set("/list/2", 3); err != nil {
+			return err
+		}
+		return tx.Set("/d", true)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayEqual(t, path, holder)
+
+	replayed, err := ReplayOpLog(path, seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := replayed.String("/", ""); got != before {
+		t.Errorf("replay until %d: %s, want %s", seq, got, before)
+	}
+
+	//事务的记录有相同的事务号, 操作者为UpdateAs 指定的
+	entries, err := ReadOpLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := entries[len(entries)-2:]
+	if last[0].Tx != last[1].Seq || last[1].Tx != last[1].Seq || last[0].Actor != "bob" {
+		t.Errorf("transaction entries %+v", last)
+	}
+
+	//重放到事务中间时整个事务不重放
+	replayed, err = ReplayOpLog(path, last[0].Seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := replayed.String("/", ""); got != before {
+		t.Errorf("replay inside transaction: %s, want %s", got, before)
+	}
+}
+
+// 写入时中断: 不完整的行及未写完的事务被忽略, 重新打开时截掉
+func TestOpLogTornTail(t *testing.T) {
+	holder, l, path := openTestLog(t, `{"a":1}`)
+	holder.SetJson("/b", 2)
+	l.Close()
+
+	info, _ := os.Stat(path)
+	size := info.Size()
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq := l.Seq()
+	file.WriteString(`{"seq":` + strconv.FormatInt(seq+1, 10) + `,"tx":` + strconv.FormatInt(seq+2, 10) + `,"time":"2024-01-01T00:00:00Z","op":"set","path":"/c","value":1}` + "\n")
+	file.WriteString(`{"seq":` + strconv.FormatInt(seq+2, 10) + `,"tx":` + strconv.FormatInt(seq+2, 10) + `,"time":"2024-01-01T00:0`)
+	file.Close()
+
+	replayEqual(t, path, holder)
+
+	l2, err := OpenOpLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+
+	if info, _ = os.Stat(path); info.Size() != size {
+		t.Errorf("size after open %d, want %d", info.Size(), size)
+	}
+	if l2.Seq() != seq {
+		t.Errorf("seq %d, want %d", l2.Seq(), seq)
+	}
+
+	holder.DetachLog()
+	if err = holder.AttachLog(l2); err != nil {
+		t.Fatal(err)
+	}
+	holder.SetJson("/d", 4)
+	replayEqual(t, path, holder)
+}
+
+func TestOpLogCompact(t *testing.T) {
+	holder, l, path := openTestLog(t, `{"a":1}`)
+	for i := 0; i < 5; i++ {
+		holder.SetJson("/n", i)
+	}
+	seq := l.Seq()
+
+	if err := holder.CompactLog(); err != nil {
+		t.Fatal(err)
+	}
+	if l.Len() != 0 || l.Seq() != seq+1 {
+		t.Errorf("after compact: len %d seq %d", l.Len(), l.Seq())
+	}
+
+	entries, _ := ReadOpLog(path)
+	if len(entries) != 1 || entries[0].Op != OpSnapshot || entries[0].Seq != seq+1 {
+		t.Fatalf("entries after compact %+v", entries)
+	}
+
+	holder.SetJson("/m", "x")
+	if l.Len() != 1 {
+		t.Errorf("len %d, want 1", l.Len())
+	}
+	replayEqual(t, path, holder)
+}
+
+// 写日志失败时修改被撤消, 订阅者不会收到事件
+func TestOpLogRollback(t *testing.T) {
+	holder, l, path := openTestLog(t, `{"a":1,"list":[1]}`)
+	holder.EnableHistory(0)
+	holder.SetJson("/b", 2)
+	before, _ := holder.String("/", "")
+
+	notified := 0
+	holder.Watch("/", func(ev ChangeEvent) { notified++ })
+
+	l.Close()
+
+	if err := holder.SetJson("/a", 5); err == nil {
+		t.Error("SetJson succeeded with closed log")
+	}
+	if _, err := holder.Remove("/list/0"); err == nil {
+		t.Error("Remove succeeded with closed log")
+	}
+	err := holder.Update(func(tx *Tx) error {
+		tx.Set("/c", 3)
+		return tx.Del("/a")
+	})
+	if err == nil {
+		t.Error("Update succeeded with closed log")
+	}
+	if err = holder.Undo(); err == nil {
+		t.Error("Undo succeeded with closed log")
+	}
+
+	if got, _ := holder.String("/", ""); got != before {
+		t.Errorf("data after failed writes %s, want %s", got, before)
+	}
+	if notified != 0 {
+		t.Errorf("notified %d times", notified)
+	}
+
+	//撤消记录不包含失败的修改
+	holder.DetachLog()
+	if err = holder.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if holder.Exist("/b") {
+		t.Error("undo did not remove /b")
+	}
+
+	entries, _ := ReadOpLog(path)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Path, "/c") || entry.Op == OpUndo {
+			t.Errorf("failed write logged: %+v", entry)
+		}
+	}
+}
+
+func TestReadOpLogTransaction(t *testing.T) {
+	log := strings.Join([]string{
+		`{"seq":1,"time":"2024-01-01T00:00:00Z","op":"snapshot","value":{}}`,
+		`{"seq":2,"tx":3,"time":"2024-01-01T00:00:00Z","op":"set","path":"/a","value":1}`,
+		`{"seq":2,"time":"2024-01-01T00:00:00Z","op":"set","path":"/b","value":2}`,
+		`{"seq":3,"tx":4,"time":"2024-01-01T00:00:00Z","op":"set","path":"/c","value":3}`,
+		`{"seq":4,"tx":4,"time":"2024-01-01T00:00:00Z","op":"set","path":"/d","value":4}`,
+		`{"seq":5,"tx":6,"time":"2024-01-01T00:00:00Z","op":"set","path":"/e","value":5}`,
+	}, "\n") + "\n"
+
+	var seqs []int64
+	end, err := readLog(strings.NewReader(log), "test", func(entry LogEntry) error {
+		seqs = append(seqs, entry.Seq)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//seq 2 的事务被后面的记录打断, seq 5 的事务没有写完
+	if want := []int64{1, 2, 3, 4}; !reflect.DeepEqual(seqs, want) {
+		t.Errorf("seqs %v, want %v", seqs, want)
+	}
+	if want := int64(strings.LastIndex(log, `{"seq":5`)); end != want {
+		t.Errorf("end %d, want %d", end, want)
+	}
+}
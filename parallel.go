@@ -0,0 +1,115 @@
+package jsnx
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// 并行处理选项
+type ParallelOptions struct {
+	Workers   int  //并发数, <=0 时为CPU 数
+	Unordered bool //结果按完成顺序返回, 默认按数组顺序
+	WriteBack bool //处理结果按数组顺序写回原数组(一次写锁内完成)
+}
+
+// 并行处理数组元素, 返回每个元素的处理结果;
+// 任一元素出错或ctx 取消时停止分配新元素, 返回第一个错误;
+// fn 不能修改传入的元素, 需要修改时返回新值并设置WriteBack
+func (holder *JsonHolder) ParallelMap(ctx context.Context, path string, opts ParallelOptions,
+	fn func(ctx context.Context, i int, nHolder *JsonHolder) (interface{}, error)) ([]interface{}, error) {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	arryNode, items, err := holder.readArry(path, opts.WriteBack)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]interface{}, len(items))
+	done := make([]interface{}, 0, len(items)) //按完成顺序的结果
+	jobs := make(chan int)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if workCtx.Err() != nil {
+					continue
+				}
+
+				result, err := fn(workCtx, i, Holder(items[i]))
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+
+				mu.Lock()
+				results[i] = result
+				done = append(done, result)
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for i := range items {
+		select {
+		case jobs <- i:
+		case <-workCtx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if opts.WriteBack {
+		err = holder.replaceArry(path, arryNode, append(make(ArryNode, 0, len(results)), results...))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Unordered {
+		return done, nil
+	}
+
+	return results, nil
+}
+
+// 并行处理数组元素
+func (holder *JsonHolder) ParallelEach(ctx context.Context, path string, workers int,
+	fn func(ctx context.Context, i int, nHolder *JsonHolder) error) error {
+	_, err := holder.ParallelMap(ctx, path, ParallelOptions{Workers: workers, Unordered: true},
+		func(ctx context.Context, i int, nHolder *JsonHolder) (interface{}, error) {
+			return nil, fn(ctx, i, nHolder)
+		})
+
+	return err
+}
@@ -0,0 +1,530 @@
+package jsnx
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSON Patch(RFC 6902) 操作
+type PatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// 序列化: add/replace/test 操作值为null 时也要输出value
+func (op PatchOp) MarshalJSON() ([]byte, error) {
+	m := MapNode{"op": op.Op, "path": op.Path}
+	if op.From != "" {
+		m["from"] = op.From
+	}
+	if op.Value != nil || op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+		m["value"] = op.Value
+	}
+
+	return json.Marshal(m)
+}
+
+// JSON Pointer 中的键值转义
+func escapeToken(key string) string {
+	key = strings.ReplaceAll(key, "~", "~0")
+	return strings.ReplaceAll(key, "/", "~1")
+}
+
+// JSON Pointer 中的键值反转义
+func unescapeToken(token string) string {
+	token = strings.ReplaceAll(token, "~1", "/")
+	return strings.ReplaceAll(token, "~0", "~")
+}
+
+// 按JSON Pointer 取结点
+func resolvePointer(node Node, pointer string) (Node, error) {
+	if pointer == "" {
+		return node, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON Pointer(%v)", pointer)
+	}
+
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = unescapeToken(token)
+
+		if mapNode, ok := node.(MapNode); ok {
+			child, exist := mapNode[token]
+			if !exist {
+				return nil, fmt.Errorf("JSON Pointer(%v) not found", pointer)
+			}
+			node = child
+			continue
+		}
+
+		items, ok := asArry(node)
+		if !ok {
+			return nil, fmt.Errorf("JSON Pointer(%v) not found", pointer)
+		}
+		idx := pointerIndex(token)
+		if idx < 0 || idx >= len(items) {
+			return nil, fmt.Errorf("JSON Pointer(%v) not found", pointer)
+		}
+		node = items[idx]
+	}
+
+	return node, nil
+}
+
+// 计算两个结点之间的JSON Patch; 两边共享的结点(写时复制)直接跳过
+func Diff(from, to interface{}) []PatchOp {
+	ops := make([]PatchOp, 0)
+	diffNode("", from, to, &ops)
+	return ops
+}
+
+func diffNode(ptr string, a, b interface{}, ops *[]PatchOp) {
+	if sameNode(a, b) {
+		return
+	}
+
+	if am, ok := a.(MapNode); ok {
+		if bm, ok := b.(MapNode); ok {
+			diffMap(ptr, am, bm, ops)
+			return
+		}
+	}
+
+	if an, ok := asArry(a); ok {
+		if bn, ok := asArry(b); ok {
+			diffArry(ptr, an, bn, ops)
+			return
+		}
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return
+	}
+
+	*ops = append(*ops, PatchOp{Op: "replace", Path: ptr, Value: b})
+}
+
+func diffMap(ptr string, a, b MapNode, ops *[]PatchOp) {
+	keys := make([]string, 0, len(a))
+	for key := range a {
+		if _, exist := b[key]; !exist {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		*ops = append(*ops, PatchOp{Op: "remove", Path: ptr + "/" + escapeToken(key)})
+	}
+
+	keys = keys[:0]
+	for key := range b {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if av, exist := a[key]; exist {
+			diffNode(ptr+"/"+escapeToken(key), av, b[key], ops)
+		} else {
+			*ops = append(*ops, PatchOp{Op: "add", Path: ptr + "/" + escapeToken(key), Value: b[key]})
+		}
+	}
+}
+
+// 数组: 跳过相同的头尾, 中间部分逐个比较, 多出的元素删除或增加
+func diffArry(ptr string, a, b ArryNode, ops *[]PatchOp) {
+	head := 0
+	for head < len(a) && head < len(b) && equalNode(a[head], b[head]) {
+		head++
+	}
+
+	tail := 0
+	for tail < len(a)-head && tail < len(b)-head && equalNode(a[len(a)-1-tail], b[len(b)-1-tail]) {
+		tail++
+	}
+
+	midA := a[head : len(a)-tail]
+	midB := b[head : len(b)-tail]
+
+	n := len(midA)
+	if len(midB) < n {
+		n = len(midB)
+	}
+
+	for i := 0; i < n; i++ {
+		diffNode(ptr+"/"+strconv.Itoa(head+i), midA[i], midB[i], ops)
+	}
+
+	for i := n; i < len(midA); i++ {
+		*ops = append(*ops, PatchOp{Op: "remove", Path: ptr + "/" + strconv.Itoa(head+n)})
+	}
+
+	for i := n; i < len(midB); i++ {
+		*ops = append(*ops, PatchOp{Op: "add", Path: ptr + "/" + strconv.Itoa(head+i), Value: midB[i]})
+	}
+}
+
+// 是否为同一个结点(容器比较地址及长度, 其它比较值)
+func sameNode(a, b interface{}) bool {
+	ida, idb := nodeId(a), nodeId(b)
+	if ida != 0 || idb != 0 {
+		return ida == idb && reflect.ValueOf(a).Len() == reflect.ValueOf(b).Len() &&
+			reflect.TypeOf(a) == reflect.TypeOf(b)
+	}
+
+	switch a.(type) {
+	case MapNode, ArryNode, ArryMapNode:
+		return false
+	}
+	switch b.(type) {
+	case MapNode, ArryNode, ArryMapNode:
+		return false
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func equalNode(a, b interface{}) bool {
+	return sameNode(a, b) || reflect.DeepEqual(a, b)
+}
+
+// 数组结点统一转换为ArryNode
+func asArry(node interface{}) (ArryNode, bool) {
+	switch n := node.(type) {
+	case ArryNode:
+		return n, true
+	case ArryMapNode:
+		arryNode := make(ArryNode, len(n))
+		for i, v := range n {
+			arryNode[i] = v
+		}
+		return arryNode, true
+	}
+
+	return nil, false
+}
+
+// 解析JSON Patch 文档(字符串/[]byte 或解析后的数组)
+func ParsePatch(data interface{}) ([]PatchOp, error) {
+	holder, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := asArry(holder.Data)
+	if !ok {
+		return nil, fmt.Errorf("patch is not an array")
+	}
+
+	ops := make([]PatchOp, len(items))
+	for i, item := range items {
+		m, ok := item.(MapNode)
+		if !ok {
+			return nil, fmt.Errorf("patch[%d] is not an object", i)
+		}
+
+		op, _ := m["op"].(string)
+		path, ok := m["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("patch[%d] path is missing", i)
+		}
+		ops[i] = PatchOp{Op: op, Path: path, Value: m["value"]}
+
+		switch op {
+		case "add", "replace", "test":
+			if _, exist := m["value"]; !exist {
+				return nil, fmt.Errorf("patch[%d] value is missing", i)
+			}
+		case "move", "copy":
+			if ops[i].From, ok = m["from"].(string); !ok {
+				return nil, fmt.Errorf("patch[%d] from is missing", i)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("patch[%d] invalid op(%v)", i, op)
+		}
+	}
+
+	return ops, nil
+}
+
+// 对指定结点应用JSON Patch(RFC 6902), 补丁中的路径相对于该结点; 全部成功才生效
+func (holder *JsonHolder) ApplyPatch(path string, ops []PatchOp) error {
+	return holder.modify(path, OpPatch, nil, func(node Node, exist bool) (Node, error) {
+		if !exist {
+			return nil, fmt.Errorf("Path(%v) not found", cleanPath(path))
+		}
+
+		return applyOps(node, ops)
+	})
+}
+
+func ApplyPatch(data interface{}, path string, ops []PatchOp) error {
+	jsx := &JsonHolder{Data: data}
+	return jsx.ApplyPatch(path, ops)
+}
+
+// 对指定结点应用JSON Merge Patch(RFC 7396): 对象逐个键值合并, null 表示删除, 其它值直接替换
+func (holder *JsonHolder) MergePatch(path string, patch interface{}) error {
+	return holder.modify(path, OpMerge, nil, func(node Node, exist bool) (Node, error) {
+		return mergeNode(node, patch), nil
+	})
+}
+
+func MergePatch(data interface{}, path string, patch interface{}) error {
+	jsx := &JsonHolder{Data: data}
+	return jsx.MergePatch(path, patch)
+}
+
+// 在一次写锁内修改结点: check 检查修改前的结点, fn 在结点的副本上计算新结点;
+// 结点已存在时原位置替换, 否则按setJson 写入
+func (holder *JsonHolder) modify(path, op string, check func(node Node, exist bool) error,
+	fn func(node Node, exist bool) (Node, error)) error {
+	holder.mu.Lock()
+	oldData := holder.beginWrite()
+
+	oldNode, exist := holder.lookup(path)
+	var err error
+	if check != nil {
+		err = check(oldNode, exist)
+	}
+
+	var newNode Node
+	if err == nil {
+		newNode, err = fn(cloneNode(oldNode), exist)
+	}
+	if err == nil {
+		if exist {
+			err = holder.replace(path, newNode)
+		} else {
+			err = holder.setJson(path, newNode)
+		}
+	}
+	ev := ChangeEvent{Path: cleanPath(path), Op: op, OldValue: oldNode, NewValue: newNode}
+	if err == nil {
+		err = holder.endWrite(oldData, op+" "+cleanPath(path), ev)
+	}
+	holder.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	holder.notify(ev)
+	return nil
+}
+
+// 依次执行补丁操作, 返回新的根结点
+func applyOps(doc Node, ops []PatchOp) (Node, error) {
+	var err error
+	for i, op := range ops {
+		doc, err = applyOp(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("patch[%d] %v %v: %v", i, op.Op, op.Path, err)
+		}
+	}
+
+	return doc, nil
+}
+
+// 执行一个补丁操作, 返回新的根结点
+func applyOp(doc Node, op PatchOp) (Node, error) {
+	switch op.Op {
+	case "add":
+		return pointerAdd(doc, op.Path, cloneNode(op.Value))
+	case "remove":
+		doc, _, err := pointerRemove(doc, op.Path)
+		return doc, err
+	case "replace":
+		if _, err := resolvePointer(doc, op.Path); err != nil {
+			return nil, err
+		}
+		if op.Path == "" {
+			return cloneNode(op.Value), nil
+		}
+		doc, _, err := pointerRemove(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, op.Path, cloneNode(op.Value))
+	case "move":
+		if op.Path == op.From {
+			return doc, nil
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("can not move a node into itself")
+		}
+		doc, value, err := pointerRemove(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, op.Path, value)
+	case "copy":
+		value, err := resolvePointer(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, op.Path, cloneNode(value))
+	case "test":
+		value, err := resolvePointer(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !schemaEqual(value, op.Value) {
+			return nil, fmt.Errorf("test failed")
+		}
+		return doc, nil
+	}
+
+	return nil, fmt.Errorf("invalid op")
+}
+
+// 拆分JSON Pointer 为父结点指针及最后一级
+func splitPointer(pointer string) (string, string, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return "", "", fmt.Errorf("invalid JSON Pointer(%v)", pointer)
+	}
+
+	i := strings.LastIndex(pointer, "/")
+	return pointer[:i], unescapeToken(pointer[i+1:]), nil
+}
+
+// 修改父结点: fn 返回新的父结点(数组长度变化时), 再写回祖父结点
+func pointerUpdate(doc Node, pointer string, fn func(parent Node, key string) (Node, error)) (Node, error) {
+	parentPtr, key, err := splitPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := resolvePointer(doc, parentPtr)
+	if err != nil {
+		return nil, err
+	}
+
+	newParent, err := fn(parent, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if parentPtr == "" {
+		return newParent, nil
+	}
+	if sameNode(parent, newParent) {
+		return doc, nil
+	}
+
+	//数组长度变化, 写回上一级
+	return pointerUpdate(doc, parentPtr, func(grand Node, key string) (Node, error) {
+		if m, ok := grand.(MapNode); ok {
+			m[key] = newParent
+			return m, nil
+		}
+		items, ok := asArry(grand)
+		if !ok {
+			return nil, fmt.Errorf("parent is not an object or array")
+		}
+		idx := pointerIndex(key)
+		if idx < 0 || idx >= len(items) {
+			return nil, fmt.Errorf("index out of range")
+		}
+		items[idx] = newParent
+		return items, nil
+	})
+}
+
+func pointerAdd(doc Node, pointer string, value Node) (Node, error) {
+	if pointer == "" {
+		return value, nil
+	}
+
+	return pointerUpdate(doc, pointer, func(parent Node, key string) (Node, error) {
+		switch n := parent.(type) {
+		case MapNode:
+			n[key] = value
+			return n, nil
+		case ArryNode:
+			idx := len(n)
+			if key != "-" {
+				idx = pointerIndex(key)
+				if idx < 0 || idx > len(n) {
+					return nil, fmt.Errorf("index out of range")
+				}
+			}
+			n = append(n, nil)
+			copy(n[idx+1:], n[idx:])
+			n[idx] = value
+			return n, nil
+		}
+
+		return nil, fmt.Errorf("parent is not an object or array")
+	})
+}
+
+func pointerRemove(doc Node, pointer string) (Node, Node, error) {
+	if pointer == "" {
+		return nil, nil, fmt.Errorf("can not remove root node")
+	}
+
+	var removed Node
+	doc, err := pointerUpdate(doc, pointer, func(parent Node, key string) (Node, error) {
+		switch n := parent.(type) {
+		case MapNode:
+			value, exist := n[key]
+			if !exist {
+				return nil, fmt.Errorf("JSON Pointer(%v) not found", pointer)
+			}
+			removed = value
+			delete(n, key)
+			return n, nil
+		case ArryNode:
+			idx := pointerIndex(key)
+			if idx < 0 || idx >= len(n) {
+				return nil, fmt.Errorf("index out of range")
+			}
+			removed = n[idx]
+			return append(n[:idx:idx], n[idx+1:]...), nil
+		}
+
+		return nil, fmt.Errorf("parent is not an object or array")
+	})
+
+	return doc, removed, err
+}
+
+// JSON Pointer 中的数组索引, 不允许前导0
+func pointerIndex(token string) int {
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || (token != "0" && strings.HasPrefix(token, "0")) || strings.HasPrefix(token, "+") {
+		return -1
+	}
+
+	return idx
+}
+
+// JSON Merge Patch
+func mergeNode(target, patch Node) Node {
+	patchMap, ok := patch.(MapNode)
+	if !ok {
+		return cloneNode(patch)
+	}
+
+	targetMap, ok := target.(MapNode)
+	if !ok {
+		targetMap = MapNode{}
+	}
+
+	for key, value := range patchMap {
+		if value == nil {
+			delete(targetMap, key)
+		} else {
+			targetMap[key] = mergeNode(targetMap[key], value)
+		}
+	}
+
+	return targetMap
+}
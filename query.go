@@ -0,0 +1,118 @@
+package jsnx
+
+import (
+	"sort"
+	"strings"
+)
+
+// 查询结果
+type Match struct {
+	Path  string //结点完整路径
+	Value Node
+}
+
+// 按路径模式查询结点: * 匹配一级的任意键值或索引, ** 匹配任意多级(含0级);
+// 其它部分与Get 的路径规则相同, 如 /orders/*/amount, /**/id
+func (holder *JsonHolder) Query(pattern string) []Match {
+	matches := make([]Match, 0)
+	holder.match(pattern, func(path string, node Node) bool {
+		matches = append(matches, Match{Path: path, Value: node})
+		return true
+	})
+
+	return matches
+}
+
+func Query(data interface{}, pattern string) []Match {
+	jsx := &JsonHolder{Data: data}
+	return jsx.Query(pattern)
+}
+
+// 在只读视图上查询, yield 返回false 时结束
+func (holder *JsonHolder) match(pattern string, yield func(path string, node Node) bool) {
+	root, done := holder.view()
+	defer done()
+
+	newPattern := strings.Trim(pattern, "/")
+	var keys []string
+	if newPattern != "" {
+		keys = strings.Split(newPattern, "/")
+	}
+
+	matchNode("/", root, keys, yield)
+}
+
+func matchNode(path string, node Node, keys []string, yield func(path string, node Node) bool) bool {
+	if len(keys) == 0 {
+		return yield(path, node)
+	}
+
+	key := keys[0]
+	switch key {
+	case "**":
+		if !matchNode(path, node, keys[1:], yield) {
+			return false
+		}
+		return matchChildren(path, node, func(childPath string, child Node) bool {
+			return matchNode(childPath, child, keys, yield)
+		})
+	case "*":
+		return matchChildren(path, node, func(childPath string, child Node) bool {
+			return matchNode(childPath, child, keys[1:], yield)
+		})
+	}
+
+	idx := arryIndex(key)
+	if idx >= 0 {
+		arryNode, ok := asArry(node)
+		if !ok || idx >= len(arryNode) {
+			return true
+		}
+		return matchNode(joinIndex(path, idx), arryNode[idx], keys[1:], yield)
+	}
+
+	mapNode, ok := node.(MapNode)
+	if !ok {
+		return true
+	}
+
+	key = strings.Trim(key, "\"")
+	child, exist := mapNode[key]
+	if !exist {
+		return true
+	}
+
+	return matchNode(joinKey(path, key), child, keys[1:], yield)
+}
+
+// 按顺序(对象按键值排序)处理子结点, fn 返回false 时结束
+func matchChildren(path string, node Node, fn func(childPath string, child Node) bool) bool {
+	switch n := node.(type) {
+	case MapNode:
+		keys := make([]string, 0, len(n))
+		for key := range n {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if !fn(joinKey(path, key), n[key]) {
+				return false
+			}
+		}
+	case ArryNode:
+		for i, v := range n {
+			if !fn(joinIndex(path, i), v) {
+				return false
+			}
+		}
+	case ArryMapNode:
+		for i, v := range n {
+			if !fn(joinIndex(path, i), v) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
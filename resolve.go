@@ -0,0 +1,369 @@
+package jsnx
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 引用关键字: {"$ref": "common.json#/defs/db"}, {"$include": "file.json"};
+// 引用对象的其它键值覆盖引用目标(目标为对象时)
+var refKeywords = []string{"$ref", "$include"}
+
+// 跨文件引用解析: 文件用ParseFile 加载并缓存, # 之后为JSON Pointer,
+// 只有# 部分时引用当前文档; 引用的文件必须在BaseDir 目录下
+type RefResolver struct {
+	BaseDir string
+
+	mu    sync.Mutex
+	files map[string]Node //已加载的文件
+}
+
+// 文档上下文: 相对路径以文档所在目录为基准
+type refDoc struct {
+	file string //绝对路径, 内存中的文档为空
+	data Node
+}
+
+// 创建解析器, baseDir 为空时为当前目录
+func NewRefResolver(baseDir string) (*RefResolver, error) {
+	if baseDir == "" {
+		baseDir = "."
+	}
+
+	dir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = real
+	}
+
+	return &RefResolver{BaseDir: dir, files: make(map[string]Node)}, nil
+}
+
+// 加载文件并内联全部引用, 只允许访问文件所在目录
+func ResolveRefs(filePath string) (*JsonHolder, error) {
+	r, err := NewRefResolver(filepath.Dir(filePath))
+	if err != nil {
+		return nil, err
+	}
+
+	return r.ResolveFile(filePath)
+}
+
+// 加载文件并内联全部引用
+func (r *RefResolver) ResolveFile(filePath string) (*JsonHolder, error) {
+	doc, err := r.open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := r.inline(doc, "/", doc.data, make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+
+	return Holder(node), nil
+}
+
+// 内联holder 中的全部引用, 返回新的holder; filePath 为文档所在位置(相对路径的基准), 为空时以BaseDir 为基准
+func (r *RefResolver) Resolve(holder *JsonHolder, filePath string) (*JsonHolder, error) {
+	doc := refDoc{}
+	if filePath != "" {
+		file, err := r.checkPath(filePath, r.BaseDir)
+		if err != nil {
+			return nil, err
+		}
+		doc.file = file
+	}
+
+	//inline 只读取原数据并复制全部容器, 读锁内完成即可
+	holder.mu.RLock()
+	doc.data = holder.Data
+	node, err := r.inline(doc, "/", doc.data, make(map[string]bool))
+	holder.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return Holder(node), nil
+}
+
+// 按需解析: 取文件中指定路径的结点, 只解析路径上经过的引用, 返回结点内部的引用保持原样
+func (r *RefResolver) Lookup(filePath, path string) (Node, error) {
+	doc, err := r.open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	node := doc.data
+	cur := "/"
+	for _, key := range pathKeys(path) {
+		if node, doc, err = r.deref(doc, cur, node, make(map[string]bool)); err != nil {
+			return nil, err
+		}
+
+		var exist bool
+		if mapNode, ok := node.(MapNode); ok {
+			node, exist = mapNode[key]
+			cur = joinKey(cur, key)
+		} else if items, ok := asArry(node); ok {
+			idx := arryIndex(key)
+			exist = idx >= 0 && idx < len(items)
+			if exist {
+				node = items[idx]
+			}
+			cur = joinIndex(cur, idx)
+		}
+		if !exist {
+			return nil, fmt.Errorf("Path(%v) not found", cleanPath(path))
+		}
+	}
+
+	if node, _, err = r.deref(doc, cur, node, make(map[string]bool)); err != nil {
+		return nil, err
+	}
+
+	return cloneNode(node), nil
+}
+
+// 打开文件(相对路径以BaseDir 为基准)
+func (r *RefResolver) open(filePath string) (refDoc, error) {
+	file, err := r.checkPath(filePath, r.BaseDir)
+	if err != nil {
+		return refDoc{}, err
+	}
+
+	data, err := r.load(file)
+	if err != nil {
+		return refDoc{}, err
+	}
+
+	return refDoc{file: file, data: data}, nil
+}
+
+// 转换为绝对路径, 并检查是否在BaseDir 目录下
+func (r *RefResolver) checkPath(filePath, dir string) (string, error) {
+	file := filePath
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	file = filepath.Clean(file)
+	if real, err := filepath.EvalSymlinks(file); err == nil {
+		file = real
+	}
+
+	rel, err := filepath.Rel(r.BaseDir, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file(%v) is outside base directory %v", filePath, r.BaseDir)
+	}
+
+	return file, nil
+}
+
+func (r *RefResolver) load(file string) (Node, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if data, ok := r.files[file]; ok {
+		return data, nil
+	}
+
+	holder, err := ParseFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	r.files[file] = holder.Data
+	return holder.Data, nil
+}
+
+// 结点为引用对象时返回关键字及引用
+func refOf(node Node) (string, string, bool) {
+	mapNode, ok := node.(MapNode)
+	if !ok {
+		return "", "", false
+	}
+
+	for _, keyword := range refKeywords {
+		if ref, ok := mapNode[keyword].(string); ok {
+			return keyword, ref, true
+		}
+	}
+
+	return "", "", false
+}
+
+// 取引用的目标(不解析目标中的引用), 返回目标所在文档及用于检测循环引用的键值;
+// seen 为本次解析经过的引用
+func (r *RefResolver) target(doc refDoc, ref string, seen map[string]bool) (Node, refDoc, string, error) {
+	file, fragment := ref, ""
+	if idx := strings.Index(ref, "#"); idx >= 0 {
+		file, fragment = ref[:idx], ref[idx+1:]
+	}
+
+	fragment, err := url.PathUnescape(fragment)
+	if err != nil {
+		return nil, doc, "", err
+	}
+
+	if file != "" {
+		if strings.Contains(file, "://") {
+			return nil, doc, "", fmt.Errorf("only local files are supported")
+		}
+
+		dir := r.BaseDir
+		if doc.file != "" {
+			dir = filepath.Dir(doc.file)
+		}
+		if file, err = r.checkPath(file, dir); err != nil {
+			return nil, doc, "", err
+		}
+
+		data, err := r.load(file)
+		if err != nil {
+			return nil, doc, "", err
+		}
+		doc = refDoc{file: file, data: data}
+	}
+
+	key := doc.file + "#" + fragment
+	if seen[key] {
+		return nil, doc, "", fmt.Errorf("circular reference")
+	}
+	seen[key] = true
+
+	node, doc, err := r.pointer(doc, fragment, seen)
+	if err != nil {
+		return nil, doc, "", err
+	}
+
+	return node, doc, key, nil
+}
+
+// 按JSON Pointer 取结点, 经过的引用对象先解析
+func (r *RefResolver) pointer(doc refDoc, pointer string, seen map[string]bool) (Node, refDoc, error) {
+	if pointer == "" {
+		return doc.data, doc, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, doc, fmt.Errorf("invalid JSON Pointer(%v)", pointer)
+	}
+
+	node := doc.data
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		var err error
+		if i > 0 {
+			if node, doc, err = r.deref(doc, "/"+strings.Join(tokens[:i], "/"), node, seen); err != nil {
+				return nil, doc, err
+			}
+		}
+
+		if node, err = resolvePointer(node, "/"+token); err != nil {
+			return nil, doc, fmt.Errorf("JSON Pointer(%v) not found", pointer)
+		}
+	}
+
+	return node, doc, nil
+}
+
+// 引用对象的其它键值覆盖目标对象
+func refSiblings(refNode MapNode, keyword string, target Node) Node {
+	targetMap, ok := target.(MapNode)
+	if !ok || len(refNode) == 1 {
+		return target
+	}
+
+	mapNode := make(MapNode, len(targetMap)+len(refNode))
+	for key, value := range targetMap {
+		mapNode[key] = value
+	}
+	for key, value := range refNode {
+		if key != keyword {
+			mapNode[key] = value
+		}
+	}
+
+	return mapNode
+}
+
+// 内联引用(返回新结点, 不修改原数据); stack 为正在展开的引用, 用于检测循环引用
+func (r *RefResolver) inline(doc refDoc, path string, node Node, stack map[string]bool) (Node, error) {
+	if keyword, ref, ok := refOf(node); ok {
+		target, targetDoc, key, err := r.target(doc, ref, make(map[string]bool))
+		if err != nil {
+			return nil, fmt.Errorf("Path(%v) %s(%v): %v", path, keyword, ref, err)
+		}
+		if stack[key] {
+			return nil, fmt.Errorf("Path(%v) %s(%v): circular reference", path, keyword, ref)
+		}
+
+		stack[key] = true
+		target, err = r.inline(targetDoc, path, target, stack)
+		delete(stack, key)
+		if err != nil {
+			return nil, err
+		}
+
+		//其它键值在当前文档中解析
+		siblings := make(MapNode)
+		for k, v := range node.(MapNode) {
+			if k == keyword {
+				continue
+			}
+			if siblings[k], err = r.inline(doc, joinKey(path, k), v, stack); err != nil {
+				return nil, err
+			}
+		}
+		siblings[keyword] = ref
+
+		return refSiblings(siblings, keyword, target), nil
+	}
+
+	switch n := node.(type) {
+	case MapNode:
+		mapNode := make(MapNode, len(n))
+		for key, value := range n {
+			v, err := r.inline(doc, joinKey(path, key), value, stack)
+			if err != nil {
+				return nil, err
+			}
+			mapNode[key] = v
+		}
+		return mapNode, nil
+	case ArryNode, ArryMapNode:
+		items, _ := asArry(n)
+		arryNode := make(ArryNode, len(items))
+		for i, value := range items {
+			v, err := r.inline(doc, joinIndex(path, i), value, stack)
+			if err != nil {
+				return nil, err
+			}
+			arryNode[i] = v
+		}
+		return arryNode, nil
+	}
+
+	return node, nil
+}
+
+// 解析结点本身的引用(可能是引用链), 返回目标及其所在文档
+func (r *RefResolver) deref(doc refDoc, path string, node Node, seen map[string]bool) (Node, refDoc, error) {
+	for {
+		keyword, ref, ok := refOf(node)
+		if !ok {
+			return node, doc, nil
+		}
+
+		target, targetDoc, _, err := r.target(doc, ref, seen)
+		if err != nil {
+			return nil, doc, fmt.Errorf("Path(%v) %s(%v): %v", path, keyword, ref, err)
+		}
+
+		node, doc = refSiblings(node.(MapNode), keyword, target), targetDoc
+	}
+}
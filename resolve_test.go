@@ -0,0 +1,200 @@
+package jsnx
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 在dir 下写入测试文件, 键值为相对路径
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestResolveRefs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.json":    `{"db":{"$ref":"common.json#/defs/db","port":2},"inc":{"$include":"sub/inc.json"},"local":{"$ref":"#/db"}}`,
+		"common.json":  `{"defs":{"db":{"host":"h","port":1}}}`,
+		"sub/inc.json": `{"host":{"$ref":"../common.json#/defs/db/host"}}`,
+	})
+
+	holder, err := ResolveRefs(filepath.Join(dir, "main.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//引用对象的其它键值覆盖目标; 相对路径以所在文档为基准
+	tests := []struct {
+		path string
+		want Node
+	}{
+		{"/db", MapNode{"host": "h", "port": 2.0}},
+		{"/inc", MapNode{"host": "h"}},
+		{"/local/host", "h"},
+		{"/local/port", 2.0},
+	}
+	for _, tt := range tests {
+		got, err := holder.Get(tt.path)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, %v, want %#v", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolveCircular(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.json":    `{"x":{"$ref":"b.json"}}`,
+		"b.json":    `{"y":{"$ref":"a.json"}}`,
+		"self.json": `{"a":{"$ref":"#/b"},"b":{"$ref":"#/a"}}`,
+		"same.json": `{"a":{"$ref":"#/c"},"b":{"$ref":"#/c"},"c":1}`,
+	})
+
+	for _, name := range []string{"a.json", "self.json"} {
+		_, err := ResolveRefs(filepath.Join(dir, name))
+		if err == nil || !strings.Contains(err.Error(), "circular reference") {
+			t.Errorf("%s: err = %v, want circular reference", name, err)
+		}
+	}
+
+	//同一目标被引用多次不是循环引用
+	if _, err := ResolveRefs(filepath.Join(dir, "same.json")); err != nil {
+		t.Errorf("same.json: %v", err)
+	}
+}
+
+func TestResolveOutsideBase(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"secret.json":    `{"password":"x"}`,
+		"app/main.json":  `{"s":{"$ref":"../secret.json"}}`,
+		"app/abs.json":   `{"s":{"$ref":"` + filepath.ToSlash(filepath.Join(root, "secret.json")) + `"}}`,
+		"app/link.json":  `{"s":{"$ref":"linked.json"}}`,
+		"app/inner.json": `{"ok":true}`,
+	})
+
+	for _, name := range []string{"main.json", "abs.json"} {
+		_, err := ResolveRefs(filepath.Join(root, "app", name))
+		if err == nil || !strings.Contains(err.Error(), "outside base directory") {
+			t.Errorf("%s: err = %v, want outside base directory", name, err)
+		}
+	}
+
+	r, err := NewRefResolver(filepath.Join(root, "app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.ResolveFile("../secret.json"); err == nil || !strings.Contains(err.Error(), "outside base directory") {
+		t.Errorf("ResolveFile outside: err = %v", err)
+	}
+
+	//符号链接按实际位置检查
+	if err = os.Symlink(filepath.Join(root, "secret.json"), filepath.Join(root, "app", "linked.json")); err != nil {
+		t.Skipf("symlink not supported: %v", err)
+	}
+	_, err = ResolveRefs(filepath.Join(root, "app", "link.json"))
+	if err == nil || !strings.Contains(err.Error(), "outside base directory") {
+		t.Errorf("symlink: err = %v, want outside base directory", err)
+	}
+
+	if err = os.Symlink(filepath.Join(root, "app", "inner.json"), filepath.Join(root, "app", "alias.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.ResolveFile("alias.json"); err != nil {
+		t.Errorf("symlink inside base: %v", err)
+	}
+}
+
+// 按需解析只解析路径上的引用: 其它位置的错误引用不影响, 返回结点内部的引用保持原样
+func TestResolveLookup(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.json":   `{"svc":{"$ref":"common.json#/defs"},"broken":{"$ref":"missing.json"},"wrap":{"inner":{"$ref":"missing.json"},"v":1}}`,
+		"common.json": `{"defs":{"db":{"host":"h"},"alias":{"$ref":"#/defs/db"}}}`,
+	})
+
+	r, err := NewRefResolver(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if host, err := r.Lookup("main.json", "/svc/db/host"); err != nil || host != "h" {
+		t.Errorf("/svc/db/host = %v, %v", host, err)
+	}
+	if host, err := r.Lookup("main.json", "/svc/alias/host"); err != nil || host != "h" {
+		t.Errorf("/svc/alias/host = %v, %v", host, err)
+	}
+
+	wrap, err := r.Lookup("main.json", "/wrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (MapNode{"inner": MapNode{"$ref": "missing.json"}, "v": 1.0}); !reflect.DeepEqual(wrap, want) {
+		t.Errorf("/wrap = %#v, want %#v", wrap, want)
+	}
+
+	if _, err = r.Lookup("main.json", "/broken"); err == nil {
+		t.Error("broken reference resolved")
+	}
+	if _, err = r.Lookup("main.json", "/svc/none"); err == nil {
+		t.Error("missing path found")
+	}
+}
+
+// 内联内存中的holder: 返回新的holder, 可以与写入同时进行
+func TestResolveHolder(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"common.json": `{"port":1}`})
+
+	r, err := NewRefResolver(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	holder, _ := NewJsonHolder(`{"a":{"$ref":"#/b"},"b":{"c":[1]},"file":{"$ref":"common.json"}}`)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			holder.SetJson("/n", i)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if _, err := r.Resolve(holder, "main.json"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	result, err := r.Resolve(holder, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port, _ := result.GetInt("/file/port"); port != 1 {
+		t.Errorf("/file/port = %d", port)
+	}
+
+	//结果不与原数据共享结点
+	result.SetJson("/a/c/0", 2)
+	if c, _ := holder.GetInt("/b/c/0"); c != 1 {
+		t.Errorf("original changed: /b/c/0 = %d", c)
+	}
+
+	if _, err = r.Resolve(holder, "../main.json"); err == nil {
+		t.Error("document outside base directory accepted")
+	}
+}
@@ -0,0 +1,907 @@
+package jsnx
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// JSON Schema 版本, 由$schema 确定, 默认为2020-12
+const (
+	Draft7    = 7
+	Draft2020 = 2020
+)
+
+// 编译后的JSON Schema, 可并发使用
+type Schema struct {
+	root    Node
+	draft   int
+	refs    map[schemaRefKey]Node     //$ref 所在对象 -> 引用的schema
+	drafts  map[uintptr]int           //schema 对象 -> 版本
+	regexps map[string]*regexp.Regexp //pattern/patternProperties, 校验时可能增加
+	mu      sync.RWMutex              //保护regexps
+}
+
+type schemaRefKey struct {
+	id      uintptr
+	keyword string
+}
+
+// 校验错误
+type SchemaError struct {
+	Path       string //实例中出错的路径(与Get 相同的格式)
+	Keyword    string //未通过的关键字
+	SchemaPath string //关键字在schema 中的位置(JSON Pointer)
+	Message    string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("Path(%v) %v: %v", e.Path, e.Keyword, e.Message)
+}
+
+// 校验不通过时返回的错误, 包含全部校验错误
+type ValidationError struct {
+	Errors []*SchemaError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// 引用关键字, $dynamicRef/$recursiveRef 按$ref 处理
+var schemaRefKeywords = []string{"$ref", "$dynamicRef", "$recursiveRef"}
+
+// 编译schema, schema 可以是JSON 字符串/[]byte, *JsonHolder 或解析后的数据;
+// 相对路径的$ref 以当前目录为基准
+func CompileSchema(schema interface{}) (*Schema, error) {
+	if holder, ok := schema.(*JsonHolder); ok {
+		holder.mu.RLock()
+		schema = holder.Data
+		holder.mu.RUnlock()
+	} else {
+		holder, err := Parse(schema)
+		if err != nil {
+			return nil, err
+		}
+		schema = holder.Data
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	return compileSchema(schema, fileURL(dir, true))
+}
+
+// 编译schema 文件, 相对路径的$ref 以文件所在目录为基准
+func CompileSchemaFile(filePath string) (*Schema, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	holder, err := ParseFile(absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return compileSchema(holder.Data, fileURL(absPath, false))
+}
+
+func fileURL(path string, isDir bool) *url.URL {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if isDir && !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+
+	return &url.URL{Scheme: "file", Path: path}
+}
+
+// 编译过程: 登记$id/$anchor, 加载$ref 引用的本地文件, 预先解析全部引用
+type schemaCompiler struct {
+	schema    *Schema
+	resources map[string]Node //资源URI(不含片段) -> 根结点
+	anchors   map[string]Node //URI#anchor -> 结点
+	pending   []pendingRef
+}
+
+type pendingRef struct {
+	key schemaRefKey
+	ref *url.URL
+}
+
+func compileSchema(root Node, base *url.URL) (*Schema, error) {
+	c := &schemaCompiler{
+		schema: &Schema{
+			root:    root,
+			draft:   Draft2020,
+			refs:    make(map[schemaRefKey]Node),
+			drafts:  make(map[uintptr]int),
+			regexps: make(map[string]*regexp.Regexp),
+		},
+		resources: make(map[string]Node),
+		anchors:   make(map[string]Node),
+	}
+
+	if mapNode, ok := root.(MapNode); ok {
+		if s, ok := mapNode["$schema"].(string); ok {
+			c.schema.draft = schemaDraft(s)
+		}
+	}
+
+	c.resources[base.String()] = root
+	if err := c.walk(root, base, c.schema.draft); err != nil {
+		return nil, err
+	}
+
+	//加载时会增加新的引用
+	for i := 0; i < len(c.pending); i++ {
+		p := c.pending[i]
+
+		doc := *p.ref
+		doc.Fragment, doc.RawFragment = "", ""
+		docRoot, exist := c.resources[doc.String()]
+		if !exist {
+			if doc.Scheme != "file" {
+				return nil, fmt.Errorf("schema: $ref(%v) only local files are supported", p.ref)
+			}
+
+			holder, err := ParseFile(filepath.FromSlash(doc.Path))
+			if err != nil {
+				return nil, fmt.Errorf("schema: $ref(%v): %v", p.ref, err)
+			}
+
+			docRoot = holder.Data
+			c.resources[doc.String()] = docRoot
+			if err = c.walk(docRoot, &doc, c.schema.draft); err != nil {
+				return nil, err
+			}
+		}
+
+		var target Node
+		switch frag := p.ref.Fragment; {
+		case frag == "":
+			target = docRoot
+		case strings.HasPrefix(frag, "/"):
+			node, err := resolvePointer(docRoot, frag)
+			if err != nil {
+				return nil, fmt.Errorf("schema: $ref(%v): %v", p.ref, err)
+			}
+			target = node
+		default:
+			node, exist := c.anchors[doc.String()+"#"+frag]
+			if !exist {
+				return nil, fmt.Errorf("schema: $ref(%v) anchor not found", p.ref)
+			}
+			target = node
+		}
+
+		c.schema.refs[p.key] = target
+	}
+
+	return c.schema, nil
+}
+
+// 按$schema 确定版本
+func schemaDraft(uri string) int {
+	for _, old := range []string{"draft-07", "draft-06", "draft-04"} {
+		if strings.Contains(uri, old) {
+			return Draft7
+		}
+	}
+
+	return Draft2020
+}
+
+func (c *schemaCompiler) walk(node Node, base *url.URL, draft int) error {
+	switch n := node.(type) {
+	case MapNode:
+		if s, ok := n["$schema"].(string); ok {
+			draft = schemaDraft(s)
+		}
+		c.schema.drafts[nodeId(n)] = draft
+
+		if id, ok := n["$id"].(string); ok {
+			u, err := base.Parse(id)
+			if err != nil {
+				return fmt.Errorf("schema: invalid $id(%v)", id)
+			}
+			if strings.HasPrefix(id, "#") {
+				//draft-07 中以 # 开头的$id 为锚点
+				c.anchors[base.String()+id] = n
+			} else {
+				u.Fragment, u.RawFragment = "", ""
+				base = u
+				c.resources[base.String()] = n
+			}
+		}
+		for _, key := range []string{"$anchor", "$dynamicAnchor"} {
+			if anchor, ok := n[key].(string); ok {
+				c.anchors[base.String()+"#"+anchor] = n
+			}
+		}
+
+		for _, key := range schemaRefKeywords {
+			if ref, ok := n[key].(string); ok {
+				u, err := base.Parse(ref)
+				if err != nil {
+					return fmt.Errorf("schema: invalid %v(%v)", key, ref)
+				}
+				c.pending = append(c.pending, pendingRef{key: schemaRefKey{nodeId(n), key}, ref: u})
+			}
+		}
+
+		if pattern, ok := n["pattern"].(string); ok {
+			if err := c.compileRegexp(pattern); err != nil {
+				return err
+			}
+		}
+
+		for key, value := range n {
+			switch key {
+			case "enum", "const", "default", "examples":
+				//数据, 不是schema
+			case "properties", "patternProperties", "$defs", "definitions", "dependentSchemas", "dependencies":
+				children, _ := value.(MapNode)
+				for name, child := range children {
+					if key == "patternProperties" {
+						if err := c.compileRegexp(name); err != nil {
+							return err
+						}
+					}
+					if _, ok := child.(MapNode); ok {
+						if err := c.walk(child, base, draft); err != nil {
+							return err
+						}
+					}
+				}
+			default:
+				if err := c.walk(value, base, draft); err != nil {
+					return err
+				}
+			}
+		}
+	case ArryNode:
+		for _, child := range n {
+			if err := c.walk(child, base, draft); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *schemaCompiler) compileRegexp(pattern string) error {
+	if _, exist := c.schema.regexps[pattern]; exist {
+		return nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("schema: invalid pattern(%v): %v", pattern, err)
+	}
+
+	c.schema.regexps[pattern] = re
+	return nil
+}
+
+// 取编译后的正则表达式: 编译时没有遍历到的pattern(如引用到enum/examples 中的schema)在校验时编译并缓存
+func (s *Schema) compiledRegexp(pattern string) (*regexp.Regexp, error) {
+	s.mu.RLock()
+	re, exist := s.regexps[pattern]
+	s.mu.RUnlock()
+	if exist {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.regexps[pattern] = re
+	s.mu.Unlock()
+	return re, nil
+}
+
+// 校验结点, 不通过时返回*ValidationError
+func (s *Schema) ValidateNode(node Node) error {
+	return s.validate(node, "/")
+}
+
+func (s *Schema) validate(node Node, path string) error {
+	v := &schemaValidator{schema: s, active: make(map[string]bool)}
+	errs, _ := v.validate(node, s.root, path, "", s.draft)
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
+	return nil
+}
+
+// 校验指定路径的结点, 错误中的路径为holder 中的完整路径
+func (holder *JsonHolder) Validate(path string, schema *Schema) error {
+	holder.mu.RLock()
+	defer holder.mu.RUnlock()
+
+	node, err := holder.get(path)
+	if err != nil {
+		return err
+	}
+
+	return schema.validate(node, cleanPath(path))
+}
+
+func Validate(data interface{}, path string, schema *Schema) error {
+	jsx := &JsonHolder{Data: data}
+	return jsx.Validate(path, schema)
+}
+
+type schemaValidator struct {
+	schema *Schema
+	active map[string]bool //正在展开的$ref, 防止循环引用
+}
+
+// 已校验过的属性及数组元素, 用于unevaluatedProperties/unevaluatedItems
+type evaluated struct {
+	props map[string]bool
+	items map[int]bool
+}
+
+func newEvaluated() *evaluated {
+	return &evaluated{props: make(map[string]bool), items: make(map[int]bool)}
+}
+
+func (ev *evaluated) merge(other *evaluated) {
+	for key := range other.props {
+		ev.props[key] = true
+	}
+	for i := range other.items {
+		ev.items[i] = true
+	}
+}
+
+func (v *schemaValidator) validate(inst Node, schema Node, path, schemaPath string, draft int) ([]*SchemaError, *evaluated) {
+	var errs []*SchemaError
+	ev := newEvaluated()
+
+	fail := func(keyword, format string, args ...interface{}) {
+		errs = append(errs, &SchemaError{
+			Path:       path,
+			Keyword:    keyword,
+			SchemaPath: schemaPath + "/" + escapeToken(keyword),
+			Message:    fmt.Sprintf(format, args...),
+		})
+	}
+
+	sch, ok := schema.(MapNode)
+	if !ok {
+		if b, ok := schema.(bool); ok && !b {
+			//false schema: 以引用它的关键字报错
+			keyword := "false"
+			tokens := strings.Split(schemaPath, "/")
+			for i := len(tokens) - 1; i > 0; i-- {
+				switch tokens[i-1] {
+				case "properties", "patternProperties", "dependentSchemas", "dependencies", "$defs", "definitions":
+					continue //属性名
+				}
+				if arryIndex(tokens[i]) < 0 {
+					keyword = unescapeToken(tokens[i])
+					break
+				}
+			}
+			errs = append(errs, &SchemaError{Path: path, Keyword: keyword, SchemaPath: schemaPath, Message: "not allowed"})
+		}
+		return errs, ev
+	}
+
+	if d, exist := v.schema.drafts[nodeId(sch)]; exist {
+		draft = d
+	}
+
+	//引用
+	for _, key := range schemaRefKeywords {
+		target, exist := v.schema.refs[schemaRefKey{nodeId(sch), key}]
+		if !exist {
+			continue
+		}
+
+		//引用回到同一个schema 而实例没有深入时停止展开
+		active := fmt.Sprintf("%x|%s", nodeId(target), path)
+		if !v.active[active] {
+			v.active[active] = true
+			subErrs, subEv := v.validate(inst, target, path, schemaPath+"/"+escapeToken(key), draft)
+			delete(v.active, active)
+
+			errs = append(errs, subErrs...)
+			ev.merge(subEv)
+		}
+
+		if draft == Draft7 && key == "$ref" {
+			return errs, ev //draft-07 中$ref 忽略同级关键字
+		}
+	}
+
+	//通用
+	if t, exist := sch["type"]; exist {
+		types := make([]string, 0)
+		if s, ok := t.(string); ok {
+			types = append(types, s)
+		} else if items, ok := asArry(t); ok {
+			for _, item := range items {
+				if s, ok := item.(string); ok {
+					types = append(types, s)
+				}
+			}
+		}
+
+		matched := false
+		for _, name := range types {
+			if schemaType(inst, name) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("type", "expected %s, got %s", strings.Join(types, " or "), typeName(inst))
+		}
+	}
+
+	if enum, exist := sch["enum"]; exist {
+		items, _ := asArry(enum)
+		found := false
+		for _, item := range items {
+			if schemaEqual(inst, item) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("enum", "value is not one of the allowed values")
+		}
+	}
+
+	if c, exist := sch["const"]; exist && !schemaEqual(inst, c) {
+		s, _ := FormatJson(c, "")
+		fail("const", "must be %s", s)
+	}
+
+	//数字
+	if schemaType(inst, "number") {
+		f, _ := toFloat(inst)
+
+		if m, ok := schemaNumber(sch["multipleOf"]); ok && m > 0 {
+			q := f / m
+			if math.Abs(q-math.Round(q)) > 1e-9 {
+				fail("multipleOf", "must be a multiple of %v", m)
+			}
+		}
+		if m, ok := schemaNumber(sch["maximum"]); ok && f > m {
+			fail("maximum", "must be <= %v", m)
+		}
+		if m, ok := schemaNumber(sch["exclusiveMaximum"]); ok && f >= m {
+			fail("exclusiveMaximum", "must be < %v", m)
+		}
+		if m, ok := schemaNumber(sch["minimum"]); ok && f < m {
+			fail("minimum", "must be >= %v", m)
+		}
+		if m, ok := schemaNumber(sch["exclusiveMinimum"]); ok && f <= m {
+			fail("exclusiveMinimum", "must be > %v", m)
+		}
+	}
+
+	//字符串
+	if s, ok := inst.(string); ok {
+		n := utf8.RuneCountInString(s)
+
+		if m, ok := schemaNumber(sch["maxLength"]); ok && float64(n) > m {
+			fail("maxLength", "length must be <= %v", m)
+		}
+		if m, ok := schemaNumber(sch["minLength"]); ok && float64(n) < m {
+			fail("minLength", "length must be >= %v", m)
+		}
+		if pattern, ok := sch["pattern"].(string); ok {
+			if re, err := v.schema.compiledRegexp(pattern); err != nil {
+				fail("pattern", "invalid pattern %q: %v", pattern, err)
+			} else if !re.MatchString(s) {
+				fail("pattern", "does not match pattern %q", pattern)
+			}
+		}
+		if format, ok := sch["format"].(string); ok {
+			if check, exist := schemaFormats[format]; exist && !check(s) {
+				fail("format", "invalid %s", format)
+			}
+		}
+	}
+
+	//数组
+	if items, ok := asArry(inst); ok {
+		prefix := 0
+		var prefixItems, rest interface{}
+		var restKeyword string
+
+		if draft == Draft7 {
+			if arry, ok := asArry(sch["items"]); ok {
+				prefixItems, rest, restKeyword = arry, sch["additionalItems"], "additionalItems"
+			} else {
+				rest, restKeyword = sch["items"], "items"
+			}
+		} else {
+			prefixItems, rest, restKeyword = sch["prefixItems"], sch["items"], "items"
+		}
+
+		if arry, ok := asArry(prefixItems); ok {
+			keyword := "prefixItems"
+			if draft == Draft7 {
+				keyword = "items"
+			}
+			for i := 0; i < len(arry) && i < len(items); i++ {
+				subErrs, _ := v.validate(items[i], arry[i], joinIndex(path, i), fmt.Sprintf("%s/%s/%d", schemaPath, keyword, i), draft)
+				errs = append(errs, subErrs...)
+				ev.items[i] = true
+			}
+			prefix = len(arry)
+		}
+
+		if rest != nil {
+			for i := prefix; i < len(items); i++ {
+				subErrs, _ := v.validate(items[i], rest, joinIndex(path, i), schemaPath+"/"+restKeyword, draft)
+				errs = append(errs, subErrs...)
+				ev.items[i] = true
+			}
+		}
+
+		if contains, exist := sch["contains"]; exist {
+			matched := 0
+			for i, item := range items {
+				if subErrs, _ := v.validate(item, contains, joinIndex(path, i), schemaPath+"/contains", draft); len(subErrs) == 0 {
+					matched++
+					ev.items[i] = true
+				}
+			}
+
+			min, ok := schemaNumber(sch["minContains"])
+			if !ok {
+				min = 1
+			}
+			if float64(matched) < min {
+				fail("contains", "must contain at least %v matching items", min)
+			}
+			if max, ok := schemaNumber(sch["maxContains"]); ok && float64(matched) > max {
+				fail("maxContains", "must contain at most %v matching items", max)
+			}
+		}
+
+		if m, ok := schemaNumber(sch["maxItems"]); ok && float64(len(items)) > m {
+			fail("maxItems", "must have at most %v items", m)
+		}
+		if m, ok := schemaNumber(sch["minItems"]); ok && float64(len(items)) < m {
+			fail("minItems", "must have at least %v items", m)
+		}
+		if unique, _ := sch["uniqueItems"].(bool); unique {
+		loop:
+			for i := range items {
+				for j := 0; j < i; j++ {
+					if schemaEqual(items[i], items[j]) {
+						fail("uniqueItems", "items %d and %d are equal", j, i)
+						break loop
+					}
+				}
+			}
+		}
+	}
+
+	//对象
+	if mapNode, ok := inst.(MapNode); ok {
+		keys := make([]string, 0, len(mapNode))
+		for key := range mapNode {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		if required, ok := asArry(sch["required"]); ok {
+			for _, item := range required {
+				if key, ok := item.(string); ok {
+					if _, exist := mapNode[key]; !exist {
+						errs = append(errs, &SchemaError{Path: joinKey(path, key), Keyword: "required",
+							SchemaPath: schemaPath + "/required", Message: "missing required property"})
+					}
+				}
+			}
+		}
+
+		properties, _ := sch["properties"].(MapNode)
+		patterns, _ := sch["patternProperties"].(MapNode)
+		additional, hasAdditional := sch["additionalProperties"]
+
+		for _, key := range keys {
+			matched := false
+
+			if sub, exist := properties[key]; exist {
+				subErrs, _ := v.validate(mapNode[key], sub, joinKey(path, key), schemaPath+"/properties/"+escapeToken(key), draft)
+				errs = append(errs, subErrs...)
+				matched = true
+			}
+
+			for pattern, sub := range patterns {
+				re, err := v.schema.compiledRegexp(pattern)
+				if err != nil {
+					fail("patternProperties", "invalid pattern %q: %v", pattern, err)
+					continue
+				}
+				if re.MatchString(key) {
+					subErrs, _ := v.validate(mapNode[key], sub, joinKey(path, key), schemaPath+"/patternProperties/"+escapeToken(pattern), draft)
+					errs = append(errs, subErrs...)
+					matched = true
+				}
+			}
+
+			if !matched && hasAdditional {
+				subErrs, _ := v.validate(mapNode[key], additional, joinKey(path, key), schemaPath+"/additionalProperties", draft)
+				errs = append(errs, subErrs...)
+				matched = true
+			}
+
+			if matched {
+				ev.props[key] = true
+			}
+		}
+
+		if names, exist := sch["propertyNames"]; exist {
+			for _, key := range keys {
+				subErrs, _ := v.validate(key, names, joinKey(path, key), schemaPath+"/propertyNames", draft)
+				errs = append(errs, subErrs...)
+			}
+		}
+
+		if m, ok := schemaNumber(sch["maxProperties"]); ok && float64(len(keys)) > m {
+			fail("maxProperties", "must have at most %v properties", m)
+		}
+		if m, ok := schemaNumber(sch["minProperties"]); ok && float64(len(keys)) < m {
+			fail("minProperties", "must have at least %v properties", m)
+		}
+
+		//dependentRequired/dependentSchemas, draft-07 中为dependencies
+		for _, keyword := range []string{"dependentRequired", "dependentSchemas", "dependencies"} {
+			deps, _ := sch[keyword].(MapNode)
+			for _, key := range keys {
+				dep, exist := deps[key]
+				if !exist {
+					continue
+				}
+
+				if required, ok := asArry(dep); ok {
+					for _, item := range required {
+						if name, ok := item.(string); ok {
+							if _, exist := mapNode[name]; !exist {
+								errs = append(errs, &SchemaError{Path: joinKey(path, name), Keyword: keyword,
+									SchemaPath: schemaPath + "/" + keyword + "/" + escapeToken(key),
+									Message:    fmt.Sprintf("required when %q is present", key)})
+							}
+						}
+					}
+					continue
+				}
+
+				subErrs, subEv := v.validate(inst, dep, path, schemaPath+"/"+keyword+"/"+escapeToken(key), draft)
+				errs = append(errs, subErrs...)
+				ev.merge(subEv)
+			}
+		}
+	}
+
+	//组合
+	if allOf, ok := asArry(sch["allOf"]); ok {
+		for i, sub := range allOf {
+			subErrs, subEv := v.validate(inst, sub, path, fmt.Sprintf("%s/allOf/%d", schemaPath, i), draft)
+			errs = append(errs, subErrs...)
+			ev.merge(subEv)
+		}
+	}
+
+	if anyOf, ok := asArry(sch["anyOf"]); ok {
+		matched := false
+		for i, sub := range anyOf {
+			if subErrs, subEv := v.validate(inst, sub, path, fmt.Sprintf("%s/anyOf/%d", schemaPath, i), draft); len(subErrs) == 0 {
+				matched = true
+				ev.merge(subEv)
+			}
+		}
+		if !matched {
+			fail("anyOf", "does not match any schema")
+		}
+	}
+
+	if oneOf, ok := asArry(sch["oneOf"]); ok {
+		matched := make([]int, 0)
+		for i, sub := range oneOf {
+			if subErrs, subEv := v.validate(inst, sub, path, fmt.Sprintf("%s/oneOf/%d", schemaPath, i), draft); len(subErrs) == 0 {
+				matched = append(matched, i)
+				ev.merge(subEv)
+			}
+		}
+		if len(matched) == 0 {
+			fail("oneOf", "does not match any schema")
+		} else if len(matched) > 1 {
+			fail("oneOf", "matches more than one schema: %v", matched)
+		}
+	}
+
+	if not, exist := sch["not"]; exist {
+		if subErrs, _ := v.validate(inst, not, path, schemaPath+"/not", draft); len(subErrs) == 0 {
+			fail("not", "must not match schema")
+		}
+	}
+
+	if cond, exist := sch["if"]; exist {
+		condErrs, condEv := v.validate(inst, cond, path, schemaPath+"/if", draft)
+
+		branch, keyword := sch["else"], "else"
+		if len(condErrs) == 0 {
+			ev.merge(condEv)
+			branch, keyword = sch["then"], "then"
+		}
+
+		if branch != nil {
+			subErrs, subEv := v.validate(inst, branch, path, schemaPath+"/"+keyword, draft)
+			errs = append(errs, subErrs...)
+			ev.merge(subEv)
+		}
+	}
+
+	//未校验过的属性及元素, 需要在其它关键字之后
+	if unevaluated, exist := sch["unevaluatedItems"]; exist && draft != Draft7 {
+		if items, ok := asArry(inst); ok {
+			for i, item := range items {
+				if !ev.items[i] {
+					subErrs, _ := v.validate(item, unevaluated, joinIndex(path, i), schemaPath+"/unevaluatedItems", draft)
+					errs = append(errs, subErrs...)
+					ev.items[i] = true
+				}
+			}
+		}
+	}
+
+	if unevaluated, exist := sch["unevaluatedProperties"]; exist && draft != Draft7 {
+		if mapNode, ok := inst.(MapNode); ok {
+			keys := make([]string, 0, len(mapNode))
+			for key := range mapNode {
+				if !ev.props[key] {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				subErrs, _ := v.validate(mapNode[key], unevaluated, joinKey(path, key), schemaPath+"/unevaluatedProperties", draft)
+				errs = append(errs, subErrs...)
+				ev.props[key] = true
+			}
+		}
+	}
+
+	return errs, ev
+}
+
+// 是否为指定的JSON 类型
+func schemaType(node Node, name string) bool {
+	switch name {
+	case "null":
+		return node == nil
+	case "boolean":
+		_, ok := node.(bool)
+		return ok
+	case "string":
+		_, ok := node.(string)
+		return ok
+	case "number":
+		return nodeRank(node) == 2
+	case "integer":
+		if nodeRank(node) != 2 {
+			return false
+		}
+		f, err := toFloat(node)
+		return err == nil && f == math.Trunc(f)
+	case "array":
+		_, ok := asArry(node)
+		return ok
+	case "object":
+		_, ok := node.(MapNode)
+		return ok
+	}
+
+	return false
+}
+
+func typeName(node Node) string {
+	for _, name := range []string{"null", "boolean", "string", "integer", "number", "array", "object"} {
+		if schemaType(node, name) {
+			return name
+		}
+	}
+
+	return fmt.Sprintf("%T", node)
+}
+
+// 按JSON 语义比较: 数字按数值, 对象不计键值顺序
+func schemaEqual(a, b Node) bool {
+	return nodeRank(a) == nodeRank(b) && CompareNode(a, b) == 0
+}
+
+func schemaNumber(node Node) (float64, bool) {
+	if nodeRank(node) != 2 {
+		return 0, false
+	}
+
+	f, err := toFloat(node)
+	return f, err == nil
+}
+
+var (
+	uuidRegexp     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hostnameRegexp = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+)
+
+// format 校验, 未知的format 忽略
+var schemaFormats = map[string]func(s string) bool{
+	"date-time": func(s string) bool {
+		_, err := time.Parse(time.RFC3339Nano, strings.ToUpper(s))
+		return err == nil
+	},
+	"date": func(s string) bool {
+		_, err := time.Parse("2006-01-02", s)
+		return err == nil
+	},
+	"time": func(s string) bool {
+		_, err := time.Parse(time.RFC3339Nano, "2006-01-02T"+strings.ToUpper(s))
+		return err == nil
+	},
+	"email": func(s string) bool {
+		addr, err := mail.ParseAddress(s)
+		return err == nil && addr.Address == s
+	},
+	"uuid": uuidRegexp.MatchString,
+	"ipv4": func(s string) bool {
+		ip := net.ParseIP(s)
+		return ip != nil && ip.To4() != nil && !strings.Contains(s, ":")
+	},
+	"ipv6": func(s string) bool {
+		return net.ParseIP(s) != nil && strings.Contains(s, ":")
+	},
+	"hostname": func(s string) bool {
+		return len(s) <= 253 && hostnameRegexp.MatchString(s)
+	},
+	"uri": func(s string) bool {
+		u, err := url.Parse(s)
+		return err == nil && u.IsAbs()
+	},
+	"uri-reference": func(s string) bool {
+		_, err := url.Parse(s)
+		return err == nil
+	},
+	"regex": func(s string) bool {
+		_, err := regexp.Compile(s)
+		return err == nil
+	},
+}
@@ -0,0 +1,169 @@
+package jsnx
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 校验不通过的路径及关键字, 按路径排序
+func schemaFailures(t *testing.T, schema *Schema, doc string) []string {
+	t.Helper()
+
+	holder, err := NewJsonHolder(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = holder.Validate("/", schema)
+	if err == nil {
+		return nil
+	}
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("error %v is not a ValidationError", err)
+	}
+
+	failures := make([]string, len(verr.Errors))
+	for i, e := range verr.Errors {
+		failures[i] = e.Path + " " + e.Keyword
+	}
+	sort.Strings(failures)
+	return failures
+}
+
+func checkSchema(t *testing.T, schema *Schema, doc string, want ...string) {
+	t.Helper()
+
+	got := schemaFailures(t, schema, doc)
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("%s: failures %q, want %q", doc, got, want)
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := CompileSchema(`{
+		"type": "object",
+		"required": ["name", "age"],
+		"properties": {
+			"name": {"type": "string", "minLength": 2},
+			"age": {"type": "integer", "minimum": 0, "maximum": 150},
+			"email": {"type": "string", "format": "email"},
+			"role": {"enum": ["admin", "user"]},
+			"tags": {"type": "array", "items": {"type": "string"}, "uniqueItems": true, "maxItems": 3},
+			"id": {"oneOf": [{"type": "integer"}, {"type": "string", "pattern": "^[a-z]+$"}]}
+		},
+		"additionalProperties": false
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkSchema(t, schema, `{"name":"Al","age":30,"email":"a@b.c","role":"admin","tags":["x","y"],"id":"abc"}`)
+	checkSchema(t, schema, `{"name":"A","age":-1}`, "/age minimum", "/name minLength")
+	checkSchema(t, schema, `{"age":1.5}`, "/age type", "/name required")
+	checkSchema(t, schema, `{"name":"Al","age":1,"email":"bad","role":"x","extra":1}`,
+		"/email format", "/extra additionalProperties", "/role enum")
+	checkSchema(t, schema, `{"name":"Al","age":1,"tags":["x","x",1,"y"]}`,
+		"/tags maxItems", "/tags uniqueItems", "/tags/2 type")
+	checkSchema(t, schema, `{"name":"Al","age":1,"id":"ABC"}`, "/id oneOf")
+	checkSchema(t, schema, `[]`, "/ type")
+}
+
+// pattern 在嵌套的子schema 及$ref 引用的schema 中同样生效
+func TestSchemaPatternNested(t *testing.T) {
+	schema, err := CompileSchema(`{
+		"$defs": {
+			"code": {"type": "string", "pattern": "^[A-Z]{3}$"},
+			"wrapped": {"properties": {"inner": {"$ref": "#/$defs/code"}}}
+		},
+		"properties": {
+			"list": {"items": {"properties": {"sku": {"pattern": "^sku-\\d+$"}}}},
+			"code": {"$ref": "#/$defs/code"},
+			"deep": {"$ref": "#/$defs/wrapped"},
+			"any": {"anyOf": [{"pattern": "^x"}, {"pattern": "^y"}]},
+			"map": {"patternProperties": {"^n_": {"pattern": "^\\d+$"}}, "additionalProperties": false}
+		}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkSchema(t, schema, `{"list":[{"sku":"sku-1"}],"code":"ABC","deep":{"inner":"XYZ"},"any":"y1","map":{"n_a":"12"}}`)
+	checkSchema(t, schema, `{"list":[{"sku":"sku-1"},{"sku":"x"}]}`, "/list/1/sku pattern")
+	checkSchema(t, schema, `{"code":"abc"}`, "/code pattern")
+	checkSchema(t, schema, `{"deep":{"inner":"ABCD"}}`, "/deep/inner pattern")
+	checkSchema(t, schema, `{"any":"z"}`, "/any anyOf")
+	checkSchema(t, schema, `{"map":{"n_a":"x","b":"1"}}`, "/map/b additionalProperties", "/map/n_a pattern")
+}
+
+// 引用到编译时不遍历的位置(如examples)中的schema: pattern 在校验时编译, 不会被跳过
+func TestSchemaPatternUncompiled(t *testing.T) {
+	schema, err := CompileSchema(`{
+		"examples": [{"type": "string", "pattern": "^ok"}, {"pattern": "("}],
+		"properties": {
+			"a": {"$ref": "#/examples/0"},
+			"b": {"$ref": "#/examples/1"}
+		}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkSchema(t, schema, `{"a":"ok!"}`)
+	checkSchema(t, schema, `{"a":"bad"}`, "/a pattern")
+	checkSchema(t, schema, `{"b":"x"}`, "/b pattern")
+
+	if _, err = CompileSchema(`{"properties":{"a":{"pattern":"("}}}`); err == nil || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Errorf("CompileSchema with invalid pattern: %v", err)
+	}
+}
+
+// 跨文件引用, 被引用文件中的pattern 同样生效
+func TestSchemaFileRef(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.json":   `{"properties":{"user":{"$ref":"common.json#/$defs/user"}}}`,
+		"common.json": `{"$defs":{"user":{"required":["id"],"properties":{"id":{"type":"string","pattern":"^u\\d+$"}}}}}`,
+	})
+
+	schema, err := CompileSchemaFile(filepath.Join(dir, "main.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkSchema(t, schema, `{"user":{"id":"u1"}}`)
+	checkSchema(t, schema, `{"user":{"id":"x1"}}`, "/user/id pattern")
+	checkSchema(t, schema, `{"user":{}}`, "/user/id required")
+
+	if _, err = CompileSchema(`{"$ref":"#/$defs/missing"}`); err == nil {
+		t.Error("missing $ref target accepted")
+	}
+}
+
+// 同一个Schema 可以并发校验, 需要配合 -race 运行
+func TestSchemaConcurrent(t *testing.T) {
+	schema, err := CompileSchema(`{"examples":[{"pattern":"^a"}],"items":{"$ref":"#/examples/0"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := Validate(ArryNode{"a1", "a2"}, "/", schema); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
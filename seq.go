@@ -0,0 +1,52 @@
+//go:build go1.23
+
+package jsnx
+
+import "iter"
+
+// 数组元素迭代器: for i, node := range holder.All(path);
+// 数组只读取一次, 迭代时不持有锁; 路径无效或不是数组时不产生元素
+func (holder *JsonHolder) All(path string) iter.Seq2[int, Node] {
+	return func(yield func(int, Node) bool) {
+		items, err := holder.arryItems(path)
+		if err != nil {
+			return
+		}
+
+		for i, node := range items {
+			if !yield(i, node) {
+				return
+			}
+		}
+	}
+}
+
+// 对象键值迭代器: for key, node := range holder.Entries(path);
+// order 默认为OrderSorted; 路径无效或不是对象时不产生元素
+func (holder *JsonHolder) Entries(path string, order ...int) iter.Seq2[string, Node] {
+	return func(yield func(string, Node) bool) {
+		iterOrder := OrderSorted
+		if len(order) > 0 {
+			iterOrder = order[0]
+		}
+
+		keys, nodes, err := holder.mapItems(path, iterOrder)
+		if err != nil {
+			return
+		}
+
+		for i, key := range keys {
+			if !yield(key, nodes[i]) {
+				return
+			}
+		}
+	}
+}
+
+// 查询结果迭代器: for path, node := range holder.Matches("/orders/*/amount");
+// 模式规则同Query, 在调用时的数据上查询(迭代期间的修改不影响结果)
+func (holder *JsonHolder) Matches(pattern string) iter.Seq2[string, Node] {
+	return func(yield func(string, Node) bool) {
+		holder.match(pattern, yield)
+	}
+}
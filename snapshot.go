@@ -0,0 +1,243 @@
+package jsnx
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 只读快照, 与holder共享数据结构; 快照不加锁读取, 不会被holder的修改影响
+type Snapshot struct {
+	data interface{}
+}
+
+// 获取当前数据的快照; 之后holder的修改只复制被修改路径上的结点(写时复制)
+func (holder *JsonHolder) Snapshot() *Snapshot {
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+
+	holder.freeze()
+	return &Snapshot{data: holder.Data}
+}
+
+// 开始只读视图, 返回当前数据及结束函数: 与快照不同, 视图期间有写操作时才冻结数据,
+// 用于遍历期间回调可能修改holder 的只读操作
+func (holder *JsonHolder) view() (interface{}, func()) {
+	holder.mu.RLock()
+	data := holder.Data
+	atomic.AddInt32(&holder.views, 1)
+	holder.mu.RUnlock()
+
+	var once sync.Once
+	return data, func() {
+		once.Do(func() { atomic.AddInt32(&holder.views, -1) })
+	}
+}
+
+// 冻结当前数据: 之后的修改先复制路径上的共享结点
+func (holder *JsonHolder) freeze() {
+	holder.shared = true
+	holder.owned = nil
+}
+
+// 写操作开始(持有写锁), 返回修改前的数据: 记录历史、写操作日志(失败时恢复)或有进行中的
+// 只读视图时冻结数据, 保证修改前的数据不再被修改; 订阅者只取事件中的新旧值, 不需要冻结
+func (holder *JsonHolder) beginWrite() interface{} {
+	if holder.history != nil || holder.oplog != nil || atomic.LoadInt32(&holder.views) > 0 {
+		holder.freeze()
+	}
+
+	return holder.Data
+}
+
+// 写操作成功结束(持有写锁): 写操作日志, 记录修改历史并保存到绑定的存储; 写日志失败时恢复修改前的数据
+func (holder *JsonHolder) endWrite(oldData interface{}, label string, events ...ChangeEvent) error {
+	defer holder.trimKeyOrder()
+
+	if holder.oplog != nil && len(events) > 0 {
+		if err := holder.oplog.append(holder.actor, events); err != nil {
+			holder.Data = oldData
+			holder.owned = nil
+			return err
+		}
+	}
+
+	if holder.history != nil {
+		holder.history.record(oldData, holder.Data, label)
+	}
+	holder.persist(events)
+	return nil
+}
+
+// 写时复制: 复制根结点及路径上(不含最终结点)被共享的容器结点
+func (holder *JsonHolder) cowPath(path string) {
+	if !holder.shared {
+		return
+	}
+
+	holder.Data = holder.own(holder.Data)
+
+	newPath := strings.Trim(path, "/")
+	if newPath == "" {
+		return
+	}
+
+	keys := strings.Split(newPath, "/")
+	node := holder.Data
+	for _, key := range keys[:len(keys)-1] {
+		idx := arryIndex(key)
+
+		switch n := node.(type) {
+		case MapNode:
+			if idx >= 0 {
+				//数字键值对应的是数组
+				return
+			}
+			key = strings.Trim(key, "\"")
+			child, exist := n[key]
+			if !exist {
+				return
+			}
+			child = holder.own(child)
+			n[key] = child
+			node = child
+		case ArryNode:
+			if idx < 0 || idx >= len(n) {
+				return
+			}
+			child := holder.own(n[idx])
+			n[idx] = child
+			node = child
+		case ArryMapNode:
+			if idx < 0 || idx >= len(n) {
+				return
+			}
+			child := holder.own(n[idx]).(MapNode)
+			n[idx] = child
+			node = child
+		default:
+			return
+		}
+	}
+}
+
+// 返回可修改的容器结点: 未复制过的共享结点复制一份(浅复制)
+func (holder *JsonHolder) own(node Node) Node {
+	var newNode Node
+
+	switch n := node.(type) {
+	case MapNode:
+		if holder.isOwned(n) {
+			return n
+		}
+		m := make(MapNode, len(n))
+		for k, v := range n {
+			m[k] = v
+		}
+		if order, ok := holder.keyOrder[nodeId(n)]; ok {
+			holder.keyOrder[nodeId(m)] = &mapOrder{node: m, keys: append([]string(nil), order.keys...)}
+		}
+		newNode = m
+	case ArryNode:
+		if holder.isOwned(n) {
+			return n
+		}
+		newNode = append(make(ArryNode, 0, len(n)), n...)
+	case ArryMapNode:
+		if holder.isOwned(n) {
+			return n
+		}
+		newNode = append(make(ArryMapNode, 0, len(n)), n...)
+	default:
+		return node
+	}
+
+	if holder.owned == nil {
+		holder.owned = make(map[uintptr]struct{})
+	}
+	if id := nodeId(newNode); id != 0 {
+		holder.owned[id] = struct{}{}
+	}
+
+	return newNode
+}
+
+// 结点是否为本次冻结后复制的结点
+func (holder *JsonHolder) isOwned(node Node) bool {
+	id := nodeId(node)
+	if id == 0 {
+		return false
+	}
+
+	_, ok := holder.owned[id]
+	return ok
+}
+
+// 容器结点标识(map 或数组底层地址), 空数组返回0
+func nodeId(node Node) uintptr {
+	v := reflect.ValueOf(node)
+	switch v.Kind() {
+	case reflect.Map:
+		return v.Pointer()
+	case reflect.Slice:
+		if v.Cap() == 0 {
+			return 0
+		}
+		return v.Pointer()
+	}
+
+	return 0
+}
+
+// 快照数据(不可修改)
+func (s *Snapshot) Data() interface{} {
+	return s.data
+}
+
+// 基于快照创建可修改的holder, 修改不影响快照及原holder
+func (s *Snapshot) Holder() *JsonHolder {
+	return &JsonHolder{Data: s.data, shared: true}
+}
+
+func (s *Snapshot) holder() *JsonHolder {
+	return &JsonHolder{Data: s.data}
+}
+
+// 获取指定位置的数据(返回的结点不可修改)
+func (s *Snapshot) Get(path string) (Node, error) {
+	return s.holder().get(path)
+}
+
+func (s *Snapshot) GetString(path string) (string, error) {
+	return s.holder().GetString(path)
+}
+
+func (s *Snapshot) GetInt(path string) (int, error) {
+	return s.holder().GetInt(path)
+}
+
+func (s *Snapshot) GetFloat(path string) (float64, error) {
+	return s.holder().GetFloat(path)
+}
+
+func (s *Snapshot) GetTime(path string, formatStr ...string) (time.Time, error) {
+	return s.holder().GetTime(path, formatStr...)
+}
+
+func (s *Snapshot) Exist(path string) bool {
+	return s.holder().Exist(path)
+}
+
+func (s *Snapshot) Keys(path string, isDeepArry bool) ([]string, error) {
+	return s.holder().Keys(path, isDeepArry)
+}
+
+func (s *Snapshot) ArryLen(path string) (int, error) {
+	return s.holder().ArryLen(path)
+}
+
+func (s *Snapshot) String(path, formatter string) (string, error) {
+	return s.holder().String(path, formatter)
+}
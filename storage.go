@@ -0,0 +1,556 @@
+package jsnx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 存储后端
+type Storage interface {
+	// 读取文档, 存储为空时返回nil
+	Load() (interface{}, error)
+	// 保存文档; changes 为本次保存对应的变更, 为nil 时保存全部数据.
+	// 绑定时在holder 的写锁内按修改顺序调用, data 只在调用期间有效, 不能保留或修改
+	Save(data interface{}, changes []ChangeEvent) error
+	// 监视存储被外部修改, 修改后的文档传给fn; 返回停止监视函数
+	Watch(fn func(data interface{})) (func(), error)
+}
+
+// 默认的外部修改检查间隔
+const DefaultPollInterval = time.Second
+
+// 绑定存储: 先从存储加载(存储为空时保存当前数据), 之后holder 的修改在提交时(释放写锁之前)
+// 按修改顺序保存, 存储被外部修改时重新加载; 返回解除绑定函数, 保存失败时调用onError
+func (holder *JsonHolder) Bind(store Storage, onError ...func(err error)) (func(), error) {
+	report := func(err error) {
+		if err != nil && len(onError) > 0 && onError[0] != nil {
+			onError[0](err)
+		}
+	}
+
+	data, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &binding{store: store}
+	holder.mu.Lock()
+	if data == nil {
+		err = store.Save(holder.Data, nil)
+	}
+	if err == nil {
+		b.reloaded = data
+		holder.bindings = append(holder.bindings, b)
+	}
+	holder.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	unbind := func() {
+		holder.mu.Lock()
+		defer holder.mu.Unlock()
+
+		for i, item := range holder.bindings {
+			if item == b {
+				holder.bindings = append(holder.bindings[:i:i], holder.bindings[i+1:]...)
+				break
+			}
+		}
+	}
+
+	if data != nil {
+		if err = parseData(holder, data); err != nil {
+			unbind()
+			return nil, err
+		}
+	}
+
+	//保存失败的错误在释放写锁后报告
+	unwatch := holder.Watch("/", func(ev ChangeEvent) {
+		for _, err := range b.takeErrors() {
+			report(err)
+		}
+	})
+
+	stop, err := store.Watch(func(data interface{}) {
+		if data == nil {
+			return
+		}
+
+		holder.mu.Lock()
+		b.reloaded = data
+		holder.mu.Unlock()
+
+		if err := parseData(holder, data); err != nil {
+			holder.mu.Lock()
+			b.reloaded = nil
+			holder.mu.Unlock()
+			report(err)
+		}
+	})
+	if err != nil {
+		unwatch()
+		unbind()
+		return nil, err
+	}
+
+	return func() {
+		stop()
+		unwatch()
+		unbind()
+	}, nil
+}
+
+// 绑定的存储
+type binding struct {
+	store    Storage
+	reloaded interface{} //外部修改重新加载的数据, 不需要再保存(持有holder 写锁时访问)
+
+	mu   sync.Mutex
+	errs []error //保存失败的错误
+}
+
+func (b *binding) takeErrors() []error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	errs := b.errs
+	b.errs = nil
+	return errs
+}
+
+// 保存到绑定的存储(持有写锁), 保证保存顺序与修改顺序一致
+func (holder *JsonHolder) persist(events []ChangeEvent) {
+	for _, b := range holder.bindings {
+		if b.reloaded != nil && len(events) == 1 && events[0].Op == OpParse && sameNode(events[0].NewValue, b.reloaded) {
+			b.reloaded = nil
+			continue
+		}
+
+		if err := b.store.Save(holder.Data, events); err != nil {
+			b.mu.Lock()
+			b.errs = append(b.errs, err)
+			b.mu.Unlock()
+		}
+	}
+}
+
+// 用已解析的数据替换holder 的数据(字符串结点不能直接交给Parse)
+func parseData(holder *JsonHolder, data interface{}) error {
+	if str, ok := data.(string); ok {
+		return holder.Parse(strconv.Quote(str))
+	}
+
+	return holder.Parse(data)
+}
+
+// 轮询检查存储的签名, 变化时重新加载
+type poller struct {
+	mu       sync.Mutex
+	sig      string //最后一次读写后的签名
+	interval time.Duration
+}
+
+// 记录自身读写后的签名, 避免被当作外部修改
+func (p *poller) mark(sig string) {
+	p.mu.Lock()
+	p.sig = sig
+	p.mu.Unlock()
+}
+
+func (p *poller) watch(signature func() string, load func() (interface{}, error), fn func(data interface{})) (func(), error) {
+	interval := p.interval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	done := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			sig := signature()
+			p.mu.Lock()
+			changed := sig != p.sig
+			p.sig = sig
+			p.mu.Unlock()
+
+			if changed {
+				if data, err := load(); err == nil {
+					fn(data)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		once.Do(func() { close(done) })
+	}, nil
+}
+
+// 文件签名: 修改时间及大小
+func fileSig(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size())
+}
+
+// 写临时文件后改名, 保证文件内容完整
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	return err
+}
+
+// 单个JSON 文件
+type FileStorage struct {
+	Path     string
+	Indent   string        //保存时的缩进, 为空时不缩进
+	Interval time.Duration //检查外部修改的间隔
+
+	poller
+	mu sync.Mutex
+}
+
+func NewFileStorage(path string) *FileStorage {
+	return &FileStorage{Path: path}
+}
+
+func (s *FileStorage) Load() (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	holder, err := ParseFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.mark(fileSig(s.Path))
+	return holder.Data, nil
+}
+
+func (s *FileStorage) Save(data interface{}, changes []ChangeEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	str, err := FormatJson(data, s.Indent)
+	if err != nil {
+		return err
+	}
+
+	if err = writeFileAtomic(s.Path, []byte(str+"\n")); err != nil {
+		return err
+	}
+
+	s.mark(fileSig(s.Path))
+	return nil
+}
+
+func (s *FileStorage) Watch(fn func(data interface{})) (func(), error) {
+	s.poller.interval = s.Interval
+	return s.watch(func() string { return fileSig(s.Path) }, s.Load, fn)
+}
+
+// 目录存储: 根结点为对象, 每个顶级键值保存为一个文件 <键值>.json
+type DirStorage struct {
+	Dir      string
+	Indent   string
+	Interval time.Duration
+
+	poller
+	mu sync.Mutex
+}
+
+func NewDirStorage(dir string) *DirStorage {
+	return &DirStorage{Dir: dir}
+}
+
+// 键值对应的文件名(转义路径分隔符等字符)
+func (s *DirStorage) file(key string) string {
+	return filepath.Join(s.Dir, url.PathEscape(key)+".json")
+}
+
+func (s *DirStorage) Load() (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data := MapNode{}
+	for _, info := range files {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, ".json") || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		key, err := url.PathUnescape(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+
+		holder, err := ParseFile(filepath.Join(s.Dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		data[key] = holder.Data
+	}
+
+	s.mark(s.signature())
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	return data, nil
+}
+
+func (s *DirStorage) Save(data interface{}, changes []ChangeEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mapNode, ok := data.(MapNode)
+	if !ok {
+		if data != nil {
+			return fmt.Errorf("DirStorage: root node is not an object")
+		}
+		mapNode = MapNode{}
+	}
+
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+
+	//只保存变更涉及的键值, 根结点变更时保存全部
+	keys := make(map[string]bool)
+	all := changes == nil
+	for _, ev := range changes {
+		pathKeys := pathKeys(ev.Path)
+		if len(pathKeys) == 0 {
+			all = true
+			break
+		}
+		keys[pathKeys[0]] = true
+	}
+	if all {
+		for key := range mapNode {
+			keys[key] = true
+		}
+
+		//删除已不存在的键值
+		files, _ := ioutil.ReadDir(s.Dir)
+		for _, info := range files {
+			key, err := url.PathUnescape(strings.TrimSuffix(info.Name(), ".json"))
+			if err == nil && strings.HasSuffix(info.Name(), ".json") && !strings.HasPrefix(info.Name(), ".") {
+				keys[key] = true
+			}
+		}
+	}
+
+	for key := range keys {
+		value, exist := mapNode[key]
+		if !exist {
+			if err := os.Remove(s.file(key)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+
+		str, err := FormatJson(value, s.Indent)
+		if err != nil {
+			return err
+		}
+		if err = writeFileAtomic(s.file(key), []byte(str+"\n")); err != nil {
+			return err
+		}
+	}
+
+	s.mark(s.signature())
+	return nil
+}
+
+func (s *DirStorage) signature() string {
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return ""
+	}
+
+	sigs := make([]string, 0, len(files))
+	for _, info := range files {
+		if strings.HasSuffix(info.Name(), ".json") && !strings.HasPrefix(info.Name(), ".") {
+			sigs = append(sigs, fmt.Sprintf("%s:%d:%d", info.Name(), info.ModTime().UnixNano(), info.Size()))
+		}
+	}
+	sort.Strings(sigs)
+
+	return strings.Join(sigs, "|")
+}
+
+func (s *DirStorage) Watch(fn func(data interface{})) (func(), error) {
+	s.poller.interval = s.Interval
+	return s.watch(s.signature, s.Load, fn)
+}
+
+// 追加日志存储: 每次变更追加一行, 加载时从最近的快照开始重放;
+// 变更行数达到CompactEvery 时将当前数据写为新的快照
+type LogStorage struct {
+	Path         string
+	CompactEvery int //0 为不自动压缩
+	Interval     time.Duration
+
+	poller
+	mu      sync.Mutex
+	entries int //最后一个快照之后的变更行数
+}
+
+func NewLogStorage(path string) *LogStorage {
+	return &LogStorage{Path: path}
+}
+
+func (s *LogStorage) Load() (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	holder := NewEmptyHolder()
+	entries := 0
+
+	end, err := readLogFile(s.Path, func(entry LogEntry) error {
+		if entry.Op == OpSnapshot {
+			entries = 0
+		} else {
+			entries++
+		}
+		return holder.replay(entry.Op, entry.Path, entry.Value)
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	//截掉写入时中断的最后一行, 以免之后追加的记录接在不完整的行后面
+	info, err := os.Stat(s.Path)
+	if err == nil && info.Size() > end {
+		err = os.Truncate(s.Path, end)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.entries = entries
+	s.mark(fileSig(s.Path))
+	return holder.Data, nil
+}
+
+func (s *LogStorage) Save(data interface{}, changes []ChangeEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if changes == nil || (s.CompactEvery > 0 && s.entries+len(changes) >= s.CompactEvery) {
+		return s.compact(data)
+	}
+
+	buff := bytes.Buffer{}
+	now := time.Now()
+	for _, ev := range changes {
+		line, err := json.Marshal(LogEntry{Time: now, Op: ev.Op, Path: ev.Path, Value: ev.NewValue})
+		if err != nil {
+			return err
+		}
+		buff.Write(line)
+		buff.WriteByte('\n')
+	}
+
+	file, err := os.OpenFile(s.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(buff.Bytes())
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	s.entries += len(changes)
+	s.mark(fileSig(s.Path))
+	return nil
+}
+
+// 将数据写为只有一个快照的新日志
+func (s *LogStorage) Compact(data interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.compact(data)
+}
+
+func (s *LogStorage) compact(data interface{}) error {
+	line, err := json.Marshal(LogEntry{Time: time.Now(), Op: OpSnapshot, Value: data})
+	if err != nil {
+		return err
+	}
+
+	if err = writeFileAtomic(s.Path, append(line, '\n')); err != nil {
+		return err
+	}
+
+	s.entries = 0
+	s.mark(fileSig(s.Path))
+	return nil
+}
+
+func (s *LogStorage) Watch(fn func(data interface{})) (func(), error) {
+	s.poller.interval = s.Interval
+	return s.watch(func() string { return fileSig(s.Path) }, s.Load, fn)
+}
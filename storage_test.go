@@ -0,0 +1,219 @@
+package jsnx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录每次保存的存储
+type memStorage struct {
+	mu    sync.Mutex
+	data  interface{}
+	saves int
+	err   error
+	watch func(data interface{})
+}
+
+func (s *memStorage) Load() (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return cloneNode(s.data), nil
+}
+
+func (s *memStorage) Save(data interface{}, changes []ChangeEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.data = cloneNode(data)
+	s.saves++
+	return nil
+}
+
+func (s *memStorage) Watch(fn func(data interface{})) (func(), error) {
+	s.mu.Lock()
+	s.watch = fn
+	s.mu.Unlock()
+
+	return func() {}, nil
+}
+
+// 并发修改时按提交顺序保存: 最后保存的数据与holder 一致
+func TestBindSaveOrder(t *testing.T) {
+	store := &memStorage{}
+	holder, _ := NewJsonHolder(`{"n":0}`)
+
+	unbind, err := holder.Bind(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unbind()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				holder.SetJson(fmt.Sprintf("/w%d", w), i)
+				holder.SetJson("/n", w*100+i)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	holder.mu.RLock()
+	data := cloneNode(holder.Data)
+	holder.mu.RUnlock()
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if !reflect.DeepEqual(store.data, data) {
+		t.Errorf("saved %v, holder %v", store.data, data)
+	}
+	if store.saves != 1+8*50*2 {
+		t.Errorf("saves = %d", store.saves)
+	}
+}
+
+// 外部修改重新加载后不再保存; 解除绑定后不再保存
+func TestBindReload(t *testing.T) {
+	store := &memStorage{data: MapNode{"a": 1.0}}
+	holder := NewEmptyHolder()
+
+	unbind, err := holder.Bind(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := holder.GetInt("/a"); a != 1 || store.saves != 0 {
+		t.Fatalf("after bind: a=%d saves=%d", a, store.saves)
+	}
+
+	store.watch(MapNode{"a": 2.0})
+	if a, _ := holder.GetInt("/a"); a != 2 || store.saves != 0 {
+		t.Errorf("after reload: a=%d saves=%d", a, store.saves)
+	}
+
+	holder.SetJson("/b", 1)
+	if store.saves != 1 {
+		t.Errorf("after SetJson: saves=%d", store.saves)
+	}
+
+	unbind()
+	holder.SetJson("/b", 2)
+	if store.saves != 1 {
+		t.Errorf("after unbind: saves=%d", store.saves)
+	}
+}
+
+// 保存失败时修改保留, 在释放写锁后报告错误(回调中可以访问holder)
+func TestBindSaveError(t *testing.T) {
+	store := &memStorage{}
+	holder, _ := NewJsonHolder(`{}`)
+
+	var reported []error
+	unbind, err := holder.Bind(store, func(err error) {
+		holder.Exist("/a")
+		reported = append(reported, err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unbind()
+
+	store.err = errors.New("disk full")
+	holder.SetJson("/a", 1)
+
+	if len(reported) != 1 || reported[0] != store.err {
+		t.Errorf("reported %v", reported)
+	}
+	if a, _ := holder.GetInt("/a"); a != 1 {
+		t.Errorf("a = %d", a)
+	}
+}
+
+func TestFileStorageBind(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.json")
+	if err := os.WriteFile(path, []byte(`{"a":1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewFileStorage(path)
+	store.Interval = 10 * time.Millisecond
+
+	holder := NewEmptyHolder()
+	unbind, err := holder.Bind(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unbind()
+
+	holder.SetJson("/b", "x")
+	saved, err := ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := saved.GetString("/b"); b != "x" {
+		t.Errorf("saved b = %q", b)
+	}
+
+	//外部修改(大小不同, 签名一定变化)
+	if err = os.WriteFile(path, []byte(`{"a":2,"c":[1,2,3]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !holder.Exist("/c") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if a, _ := holder.GetInt("/a"); a != 2 || holder.Exist("/b") {
+		s, _ := holder.String("/", "")
+		t.Errorf("after external change: %s", s)
+	}
+}
+
+// 写入时中断: 加载时截掉不完整的最后一行, 之后追加的记录可以正常加载
+func TestLogStorageTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.log")
+	store := NewLogStorage(path)
+
+	if err := store.Save(MapNode{"a": 1.0}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(nil, []ChangeEvent{{Op: OpSet, Path: "/b", NewValue: 2.0}}); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"time":"2024-01-01T00:0`)
+	file.Close()
+
+	data, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (MapNode{"a": 1.0, "b": 2.0}); !reflect.DeepEqual(data, want) {
+		t.Errorf("loaded %v, want %v", data, want)
+	}
+
+	if err = store.Save(nil, []ChangeEvent{{Op: OpSet, Path: "/c", NewValue: 3.0}}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = NewLogStorage(path).Load(); err != nil {
+		t.Fatal(err)
+	}
+	if want := (MapNode{"a": 1.0, "b": 2.0, "c": 3.0}); !reflect.DeepEqual(data, want) {
+		t.Errorf("loaded after save %v, want %v", data, want)
+	}
+}
@@ -0,0 +1,352 @@
+package jsnx
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 数据转换, 规则为JSON:
+//
+//	{"mappings": [
+//	  {"target": "/user/name", "source": "/name"},                  字段复制/改名
+//	  {"target": "/user/id", "source": "/id", "required": true},    必填字段
+//	  {"target": "/note", "source": "/memo", "default": ""},        源数据不存在(或为null)时的默认值
+//	  {"target": "/total", "expr": "price * qty"},                  表达式(见CompileExpr)
+//	  {"target": "/kind", "const": "order"},                        常量
+//	  {"target": "/vip", "const": true, "when": "level > 3"},       条件成立时才写入
+//	  {"target": "/lines", "source": "/items", "each": [...]}       数组逐个元素转换, 元素内路径相对于元素
+//	]}
+//
+// 规则也可以直接是mappings 数组
+type Transform struct {
+	mappings []*mapping
+}
+
+// 转换结果报告
+type TransformReport struct {
+	Missing  []string //必填但没有值的字段(目标路径)
+	Unmapped []string //源数据中没有被引用的叶子结点路径
+}
+
+// 单条映射规则
+type mapping struct {
+	target   string
+	source   string
+	expr     *Expr
+	when     *Expr
+	constant interface{}
+	hasConst bool
+	def      interface{}
+	hasDef   bool
+	required bool
+	each     []*mapping
+}
+
+// 编译转换规则, spec 可以是JSON 字符串/[]byte, *JsonHolder 或解析后的数据
+func CompileTransform(spec interface{}) (*Transform, error) {
+	if holder, ok := spec.(*JsonHolder); ok {
+		holder.mu.RLock()
+		spec = holder.Data
+		holder.mu.RUnlock()
+	} else {
+		holder, err := Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		spec = holder.Data
+	}
+
+	if mapNode, ok := spec.(MapNode); ok {
+		spec = mapNode["mappings"]
+	}
+
+	mappings, err := compileMappings(spec, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transform{mappings: mappings}, nil
+}
+
+func compileMappings(spec interface{}, prefix string) ([]*mapping, error) {
+	items, ok := asArry(spec)
+	if !ok {
+		return nil, fmt.Errorf("transform: mappings%s is not an array", prefix)
+	}
+
+	mappings := make([]*mapping, 0, len(items))
+	for i, item := range items {
+		pos := fmt.Sprintf("%s[%d]", prefix, i)
+
+		rule, ok := item.(MapNode)
+		if !ok {
+			return nil, fmt.Errorf("transform: mappings%s is not an object", pos)
+		}
+
+		m := &mapping{}
+		for key, value := range rule {
+			switch key {
+			case "target", "source":
+				s, ok := value.(string)
+				if !ok {
+					return nil, fmt.Errorf("transform: mappings%s.%s is not a string", pos, key)
+				}
+				if key == "target" {
+					m.target = s
+				} else {
+					m.source = s
+				}
+			case "expr", "when":
+				s, ok := value.(string)
+				if !ok {
+					return nil, fmt.Errorf("transform: mappings%s.%s is not a string", pos, key)
+				}
+				e, err := CompileExpr(s)
+				if err != nil {
+					return nil, fmt.Errorf("transform: mappings%s.%s: %v", pos, key, err)
+				}
+				if key == "expr" {
+					m.expr = e
+				} else {
+					m.when = e
+				}
+			case "const":
+				m.constant, m.hasConst = value, true
+			case "default":
+				m.def, m.hasDef = value, true
+			case "required":
+				m.required, _ = value.(bool)
+			case "each":
+				each, err := compileMappings(value, pos+".each")
+				if err != nil {
+					return nil, err
+				}
+				m.each = each
+			default:
+				return nil, fmt.Errorf("transform: mappings%s has unknown key %q", pos, key)
+			}
+		}
+
+		if _, exist := rule["target"]; !exist {
+			return nil, fmt.Errorf("transform: mappings%s.target is required", pos)
+		}
+
+		n := 0
+		for _, set := range []bool{m.source != "", m.expr != nil, m.hasConst} {
+			if set {
+				n++
+			}
+		}
+		if n != 1 && !(n == 0 && m.hasDef) {
+			return nil, fmt.Errorf("transform: mappings%s needs exactly one of source, expr or const", pos)
+		}
+		if m.each != nil && m.source == "" && m.expr == nil {
+			return nil, fmt.Errorf("transform: mappings%s.each needs source or expr", pos)
+		}
+
+		mappings = append(mappings, m)
+	}
+
+	return mappings, nil
+}
+
+// 转换源数据, 返回新的holder; 有必填字段缺失时同时返回错误
+func (t *Transform) Apply(src *JsonHolder) (*JsonHolder, *TransformReport, error) {
+	src.mu.RLock()
+	defer src.mu.RUnlock()
+
+	report := &TransformReport{Missing: make([]string, 0), Unmapped: make([]string, 0)}
+	refs := make([][]string, 0)
+
+	dst := NewEmptyHolder()
+	err := applyMappings(t.mappings, src.Data, dst, "", "", report, &refs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	//没有被引用的叶子结点
+	leaves := make(map[string]interface{})
+	flattenNode("", src.Data, "/", FlatIndex, leaves)
+	for leaf := range leaves {
+		if leaf == "" {
+			continue
+		}
+		if !referenced(pathKeys(leaf), refs) {
+			report.Unmapped = append(report.Unmapped, "/"+leaf)
+		}
+	}
+	sort.Strings(report.Unmapped)
+
+	if len(report.Missing) > 0 {
+		return dst, report, fmt.Errorf("transform: missing required fields: %s", strings.Join(report.Missing, ", "))
+	}
+
+	return dst, report, nil
+}
+
+// 按规则转换
+func (holder *JsonHolder) Transform(spec interface{}) (*JsonHolder, *TransformReport, error) {
+	t, err := CompileTransform(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return t.Apply(holder)
+}
+
+// srcPrefix/dstPrefix 为元素在源数据/目标数据中的路径(数组元素中的索引用 * 表示)
+func applyMappings(mappings []*mapping, src Node, dst *JsonHolder, srcPrefix, dstPrefix string,
+	report *TransformReport, refs *[][]string) error {
+	for _, m := range mappings {
+		target := subPath(dstPrefix, m.target)
+
+		if m.source != "" && m.each == nil {
+			*refs = append(*refs, pathKeys(subPath(srcPrefix, m.source)))
+		}
+		for _, e := range []*Expr{m.expr, m.when} {
+			if e != nil {
+				for _, path := range e.Paths() {
+					*refs = append(*refs, pathKeys(subPath(srcPrefix, path)))
+				}
+			}
+		}
+
+		if m.when != nil {
+			ok, err := m.when.EvalNode(src)
+			if err != nil {
+				return fmt.Errorf("transform: %s when: %v", target, err)
+			}
+			if !truthy(ok) {
+				continue
+			}
+		}
+
+		var value interface{}
+		switch {
+		case m.hasConst:
+			value = cloneNode(m.constant)
+		case m.expr != nil:
+			v, err := m.expr.EvalNode(src)
+			if err != nil {
+				return fmt.Errorf("transform: %s expr: %v", target, err)
+			}
+			value = v
+		case m.source != "":
+			v, err := Holder(src).get(m.source)
+			if err == nil {
+				value = cloneNode(v)
+			}
+		}
+
+		if value != nil && m.each != nil {
+			items, ok := asArry(value)
+			if !ok {
+				return fmt.Errorf("transform: %s each: source is not an array", target)
+			}
+
+			//数组元素的引用由each 中的规则确定, 非容器元素视为整体被引用
+			elemPrefix := subPath(srcPrefix, m.source) + "/*"
+			if len(items) == 0 {
+				*refs = append(*refs, pathKeys(subPath(srcPrefix, m.source)))
+			}
+
+			result := make(ArryNode, len(items))
+			for i, item := range items {
+				switch item.(type) {
+				case MapNode, ArryNode, ArryMapNode:
+				default:
+					*refs = append(*refs, pathKeys(elemPrefix))
+				}
+
+				elem := NewEmptyHolder()
+				err := applyMappings(m.each, item, elem, elemPrefix,
+					joinIndex(target, i), report, refs)
+				if err != nil {
+					return err
+				}
+				result[i] = elem.Data
+			}
+			value = result
+		}
+
+		if value == nil && m.hasDef {
+			value = cloneNode(m.def)
+		}
+
+		if value == nil && m.required {
+			report.Missing = append(report.Missing, target)
+			continue
+		}
+
+		if value == nil && !m.hasDef && !m.hasConst {
+			continue //源数据不存在时不写入
+		}
+
+		if err := dst.setJson(m.target, value); err != nil {
+			return fmt.Errorf("transform: %s: %v", target, err)
+		}
+	}
+
+	return nil
+}
+
+// 拼接相对路径
+func subPath(prefix, path string) string {
+	if prefix != "" && strings.Trim(path, "/") == "" {
+		return prefix
+	}
+
+	return prefix + cleanPath(path)
+}
+
+// 叶子结点是否被引用(引用路径是叶子路径的前缀, * 匹配数组索引)
+func referenced(leaf []string, refs [][]string) bool {
+	for _, ref := range refs {
+		if len(ref) > len(leaf) {
+			continue
+		}
+
+		matched := true
+		for i, key := range ref {
+			if key != leaf[i] && !(key == "*" && arryIndex(leaf[i]) >= 0) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 深度复制结点
+func cloneNode(node Node) Node {
+	switch n := node.(type) {
+	case MapNode:
+		m := make(MapNode, len(n))
+		for k, v := range n {
+			m[k] = cloneNode(v)
+		}
+		return m
+	case ArryNode:
+		a := make(ArryNode, len(n))
+		for i, v := range n {
+			a[i] = cloneNode(v)
+		}
+		return a
+	case ArryMapNode:
+		a := make(ArryNode, len(n))
+		for i, v := range n {
+			a[i] = cloneNode(v)
+		}
+		return a
+	case json.Number:
+		return n
+	}
+
+	return node
+}
@@ -0,0 +1,122 @@
+package jsnx
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	src, err := NewJsonHolder(`{
+		"id": 7,
+		"name": "Alice",
+		"level": 5,
+		"memo": null,
+		"extra": {"a": 1, "b": [1, 2]},
+		"items": [{"sku": "x", "price": 2, "qty": 3, "note": "n"}, {"sku": "y", "price": 5, "qty": 1}],
+		"tags": ["t1", "t2"]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec := `{"mappings": [
+		{"target": "/user/name", "source": "/name"},
+		{"target": "/user/id", "source": "id", "required": true},
+		{"target": "/note", "source": "/memo", "default": ""},
+		{"target": "/kind", "const": "order"},
+		{"target": "/vip", "const": true, "when": "level > 3"},
+		{"target": "/basic", "const": true, "when": "level <= 3"},
+		{"target": "/missing", "source": "/nothing"},
+		{"target": "/tags", "source": "/tags", "each": [{"target": "/", "expr": "upper($)"}]},
+		{"target": "/lines", "source": "/items", "each": [
+			{"target": "/code", "source": "/sku"},
+			{"target": "/total", "expr": "price * qty"}
+		]}
+	]}`
+
+	dst, report, err := src.Transform(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//条件不成立及源数据不存在的字段不写入
+	want := `{"kind":"order","lines":[{"code":"x","total":6},{"code":"y","total":5}],"note":"","tags":["T1","T2"],"user":{"id":7,"name":"Alice"},"vip":true}`
+	if got, _ := dst.String("/", ""); got != want {
+		t.Errorf("result %s\nwant %s", got, want)
+	}
+
+	//没有被引用的叶子结点: extra 及 items 中的 note
+	wantUnmapped := []string{"/extra/a", "/extra/b/0", "/extra/b/1", "/items/0/note"}
+	if !reflect.DeepEqual(report.Unmapped, wantUnmapped) {
+		t.Errorf("Unmapped %v, want %v", report.Unmapped, wantUnmapped)
+	}
+	if len(report.Missing) != 0 {
+		t.Errorf("Missing %v", report.Missing)
+	}
+
+	//源数据不变
+	if name, _ := src.GetString("/name"); name != "Alice" {
+		t.Errorf("source changed: name %q", name)
+	}
+}
+
+func TestTransformMissing(t *testing.T) {
+	src, _ := NewJsonHolder(`{"a":1,"items":[{"x":1},{}]}`)
+
+	tr, err := CompileTransform(`[
+		{"target": "/id", "source": "/id", "required": true},
+		{"target": "/a", "source": "/a"},
+		{"target": "/xs", "source": "/items", "each": [{"target": "/x", "source": "/x", "required": true}]}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//缺少必填字段时返回错误, 同时返回已转换的数据及报告
+	dst, report, err := tr.Apply(src)
+	if err == nil || !strings.Contains(err.Error(), "/id") {
+		t.Errorf("error %v, want missing /id", err)
+	}
+	if want := []string{"/id", "/xs/1/x"}; report == nil || !reflect.DeepEqual(report.Missing, want) {
+		t.Fatalf("Missing %v, want %v", report, want)
+	}
+	if a, _ := dst.GetInt("/a"); a != 1 {
+		t.Errorf("a = %d", a)
+	}
+}
+
+func TestCompileTransformErrors(t *testing.T) {
+	tests := []struct {
+		spec, msg string
+	}{
+		{`{"mappings": {}}`, "not an array"},
+		{`[1]`, "mappings[0] is not an object"},
+		{`[{"source": "/a"}]`, "mappings[0].target is required"},
+		{`[{"target": "/a"}]`, "exactly one of source, expr or const"},
+		{`[{"target": "/a", "source": "/a", "const": 1}]`, "exactly one of source, expr or const"},
+		{`[{"target": "/a", "expr": "1 +"}]`, "mappings[0].expr"},
+		{`[{"target": "/a", "source": 1}]`, "mappings[0].source is not a string"},
+		{`[{"target": "/a", "source": "/a", "bad": 1}]`, `unknown key "bad"`},
+		{`[{"target": "/a", "const": 1, "each": []}]`, "each needs source or expr"},
+		{`[{"target": "/a", "source": "/a", "each": [{"target": "/b"}]}]`, "mappings[0].each[0]"},
+	}
+
+	for _, tt := range tests {
+		_, err := CompileTransform(tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("CompileTransform(%s) error %v, want %q", tt.spec, err, tt.msg)
+		}
+	}
+
+	//运行时错误
+	src, _ := NewJsonHolder(`{"a":"x","b":1}`)
+	for spec, msg := range map[string]string{
+		`[{"target": "/c", "expr": "a * 2"}]`:                                       "/c expr",
+		`[{"target": "/c", "source": "/b", "each": [{"target": "/", "const": 1}]}]`: "source is not an array",
+	} {
+		if _, _, err := src.Transform(spec); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("Transform(%s) error %v, want %q", spec, err, msg)
+		}
+	}
+}
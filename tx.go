@@ -0,0 +1,115 @@
+package jsnx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 事务, 只在Update的回调函数内有效
+type Tx struct {
+	holder *JsonHolder
+	events []ChangeEvent
+}
+
+// 在同一写锁下执行多个操作: fn 返回nil 时提交, 返回错误或panic 时恢复到执行前的数据;
+// 变更事件在提交并释放锁之后派发; fn 内不能再调用holder的加锁方法
+func (holder *JsonHolder) Update(fn func(tx *Tx) error) error {
+	return holder.update("", fn)
+}
+
+func (holder *JsonHolder) update(actor string, fn func(tx *Tx) error) (err error) {
+	var committed bool
+
+	holder.mu.Lock()
+	oldData := holder.beginWrite()
+	holder.freeze() //写时复制, 保证回滚时原数据未被修改
+	holder.actor = actor
+	tx := &Tx{holder: holder}
+
+	defer func() {
+		if committed {
+			//写操作日志失败时endWrite 已恢复原数据
+			if err = holder.endWrite(oldData, "update", tx.events...); err != nil {
+				committed = false
+			}
+		} else {
+			holder.Data = oldData
+			holder.owned = nil
+		}
+		holder.actor = ""
+		holder.mu.Unlock()
+
+		if committed {
+			holder.notify(tx.events...)
+		}
+	}()
+
+	err = fn(tx)
+	if err == nil {
+		committed = true
+	}
+
+	return err
+}
+
+// 获取指定位置的数据
+func (tx *Tx) Get(path string) (Node, error) {
+	return tx.holder.get(path)
+}
+
+// 判断结点是否存在
+func (tx *Tx) Exist(path string) bool {
+	node, err := tx.holder.get(path)
+	return err == nil && node != nil
+}
+
+// 设置指定结点, 规则同SetJson
+func (tx *Tx) Set(path string, jsonObj interface{}) error {
+	evPath := tx.holder.setPath(path)
+	oldNode, _ := tx.holder.get(evPath)
+
+	err := tx.holder.setJson(path, jsonObj)
+	if err != nil {
+		return err
+	}
+
+	tx.events = append(tx.events, ChangeEvent{Path: evPath, Op: OpSet, OldValue: oldNode, NewValue: jsonObj})
+	return nil
+}
+
+// 删除指定结点
+func (tx *Tx) Del(path string) error {
+	if strings.Trim(path, "/") == "" {
+		return nil
+	}
+
+	oldNode, _ := tx.holder.get(path)
+
+	err := tx.holder.del(path)
+	if err != nil {
+		return err
+	}
+
+	tx.events = append(tx.events, ChangeEvent{Path: cleanPath(path), Op: OpDel, OldValue: oldNode})
+	return nil
+}
+
+// 移动结点: 先删除from, 再按SetJson规则写入to
+func (tx *Tx) Move(from, to string) error {
+	if strings.Trim(from, "/") == "" {
+		return fmt.Errorf("can not move root node")
+	}
+
+	node, err := tx.holder.get(from)
+	if err != nil {
+		return err
+	}
+
+	err = tx.holder.del(from)
+	if err != nil {
+		return err
+	}
+	tx.events = append(tx.events, ChangeEvent{Path: cleanPath(from), Op: OpRemove, OldValue: node})
+
+	return tx.Set(to, node)
+}
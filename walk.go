@@ -0,0 +1,162 @@
+package jsnx
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// 结点类型(同NodePos.PreType)
+const (
+	NodeRoot    = 0 //根结点
+	NodeMap     = 1 //MapNode
+	NodeArry    = 2 //ArryNode
+	NodeArryMap = 3 //ArryMapNode
+)
+
+var (
+	SkipSubtree = errors.New("skip subtree") //Walk 回调返回时, 不遍历当前结点的子结点
+	StopWalk    = errors.New("stop walk")    //Walk 回调返回时, 结束遍历
+)
+
+// 遍历时的结点信息
+type WalkNode struct {
+	Path       string //完整路径, 可直接用于Get/SetJson
+	Depth      int    //深度, 起始结点为0
+	ParentType int    //上级结点类型, 起始结点为NodeRoot
+	Key        string //上级为对象时的键值
+	Index      int    //上级为数组时的索引, 否则为-1
+	Value      Node
+}
+
+// 从指定结点开始遍历所有子结点(默认深度优先, breadthFirst=true 时广度优先);
+// 遍历的是调用时的快照, 回调中可以修改holder
+func (holder *JsonHolder) Walk(path string, fn func(node *WalkNode) error, breadthFirst ...bool) error {
+	data, done := holder.view()
+	defer done()
+
+	node, err := (&JsonHolder{Data: data}).get(path)
+	if err != nil {
+		return err
+	}
+
+	start := &WalkNode{Path: cleanPath(path), ParentType: NodeRoot, Index: -1, Value: node}
+	if len(breadthFirst) > 0 && breadthFirst[0] {
+		err = walkBreadth(start, fn)
+	} else {
+		err = walkDepth(start, fn)
+	}
+
+	if err == StopWalk {
+		return nil
+	}
+
+	return err
+}
+
+// 包装数据并遍历
+func Walk(data interface{}, path string, fn func(node *WalkNode) error, breadthFirst ...bool) error {
+	jsx := &JsonHolder{Data: data}
+	return jsx.Walk(path, fn, breadthFirst...)
+}
+
+func walkDepth(wn *WalkNode, fn func(node *WalkNode) error) error {
+	err := fn(wn)
+	if err == SkipSubtree {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, child := range walkChildren(wn) {
+		err = walkDepth(child, fn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkBreadth(start *WalkNode, fn func(node *WalkNode) error) error {
+	queue := []*WalkNode{start}
+	for len(queue) > 0 {
+		wn := queue[0]
+		queue = queue[1:]
+
+		err := fn(wn)
+		if err == SkipSubtree {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		queue = append(queue, walkChildren(wn)...)
+	}
+
+	return nil
+}
+
+// 子结点列表, 对象按键值排序
+func walkChildren(wn *WalkNode) []*WalkNode {
+	var children []*WalkNode
+
+	switch n := wn.Value.(type) {
+	case MapNode:
+		keys := make([]string, 0, len(n))
+		for key := range n {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		children = make([]*WalkNode, 0, len(keys))
+		for _, key := range keys {
+			children = append(children, &WalkNode{
+				Path: joinKey(wn.Path, key), Depth: wn.Depth + 1, ParentType: NodeMap,
+				Key: key, Index: -1, Value: n[key],
+			})
+		}
+	case ArryNode:
+		children = make([]*WalkNode, 0, len(n))
+		for i, v := range n {
+			children = append(children, &WalkNode{
+				Path: joinIndex(wn.Path, i), Depth: wn.Depth + 1, ParentType: NodeArry,
+				Index: i, Value: v,
+			})
+		}
+	case ArryMapNode:
+		children = make([]*WalkNode, 0, len(n))
+		for i, v := range n {
+			children = append(children, &WalkNode{
+				Path: joinIndex(wn.Path, i), Depth: wn.Depth + 1, ParentType: NodeArryMap,
+				Index: i, Value: v,
+			})
+		}
+	}
+
+	return children
+}
+
+// 拼接对象键值路径: 数字或空键值加双引号, 以区分数组索引
+func joinKey(path, key string) string {
+	if arryIndex(key) >= 0 {
+		key = "\"" + key + "\""
+	}
+
+	if path == "" || path == "/" {
+		return "/" + key
+	}
+
+	return path + "/" + key
+}
+
+// 拼接数组索引路径
+func joinIndex(path string, idx int) string {
+	if path == "" || path == "/" {
+		return "/" + strconv.Itoa(idx)
+	}
+
+	return path + "/" + strconv.Itoa(idx)
+}
@@ -0,0 +1,161 @@
+package jsnx
+
+import (
+	"strconv"
+	"strings"
+)
+
+// 变更操作类型
+const (
+	OpSet     = "set"     //SetJson
+	OpDel     = "del"     //Del
+	OpRemove  = "remove"  //Remove
+	OpReplace = "replace" //替换已存在的结点
+	OpParse   = "parse"   //Parse, ParseFile
+	OpClear   = "clear"   //Clear
+	OpMerge   = "merge"   //合并
+	OpPatch   = "patch"   //补丁
+	OpUndo    = "undo"    //撤消
+	OpRedo    = "redo"    //重做
+)
+
+// 变更事件; 新旧值与holder 共享结点, 回调返回后还需要使用时先复制
+type ChangeEvent struct {
+	Path     string      //变更结点路径, 根结点为 "/"
+	Op       string      //操作类型
+	OldValue interface{} //变更前的值
+	NewValue interface{} //变更后的值, 删除时为nil
+}
+
+// 变更订阅者
+type watcher struct {
+	id     int
+	prefix []string
+	fn     func(ev ChangeEvent)
+}
+
+// 订阅指定路径(含子结点及上级结点)的变更, 返回取消订阅函数;
+// 回调在释放holder锁之后执行, 回调中可以再次读写holder
+func (holder *JsonHolder) Watch(pathPrefix string, fn func(ev ChangeEvent)) func() {
+	holder.wmu.Lock()
+	defer holder.wmu.Unlock()
+
+	holder.watchSeq++
+	w := &watcher{id: holder.watchSeq, prefix: pathKeys(pathPrefix), fn: fn}
+	holder.watchers = append(holder.watchers, w)
+
+	return func() {
+		holder.wmu.Lock()
+		defer holder.wmu.Unlock()
+
+		for i, item := range holder.watchers {
+			if item.id == w.id {
+				holder.watchers = append(holder.watchers[:i:i], holder.watchers[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// 派发变更事件(调用时不能持有holder.mu)
+func (holder *JsonHolder) notify(events ...ChangeEvent) {
+	holder.wmu.Lock()
+	if len(holder.watchers) == 0 {
+		holder.wmu.Unlock()
+		return
+	}
+	watchers := make([]*watcher, len(holder.watchers))
+	copy(watchers, holder.watchers)
+	holder.wmu.Unlock()
+
+	for _, ev := range events {
+		keys := pathKeys(ev.Path)
+		for _, w := range watchers {
+			if pathOverlap(w.prefix, keys) {
+				w.fn(ev)
+			}
+		}
+	}
+}
+
+// 规范化路径, 根结点为 "/"
+func cleanPath(path string) string {
+	return "/" + strings.Trim(path, "/")
+}
+
+// 拆分路径, 去掉键值两端的双引号
+func pathKeys(path string) []string {
+	newPath := strings.Trim(path, "/")
+	if newPath == "" {
+		return nil
+	}
+
+	keys := strings.Split(newPath, "/")
+	for i, key := range keys {
+		if strings.HasPrefix(key, "\"") && strings.HasSuffix(key, "\"") {
+			keys[i] = strings.Trim(key, "\"")
+		}
+	}
+
+	return keys
+}
+
+// 两个路径是否存在包含关系
+func pathOverlap(a, b []string) bool {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// 解析路径中的一级: 返回数组索引(>=0) 或 -1 表示对象键值
+func arryIndex(key string) int {
+	if key == "" {
+		return 0
+	}
+
+	if strings.HasPrefix(key, "\"") && strings.HasSuffix(key, "\"") {
+		return -1
+	}
+
+	idx, err := strconv.ParseInt(key, 10, 32)
+	if err != nil || idx < 0 {
+		return -1
+	}
+
+	return int(idx)
+}
+
+// 计算SetJson实际写入的路径: 最终结点为数组时, 值追加在数组末尾(不足时补空白)
+func (holder *JsonHolder) setPath(path string) string {
+	newPath := strings.Trim(path, "/")
+	if newPath == "" {
+		return "/"
+	}
+
+	keys := strings.Split(newPath, "/")
+	last := len(keys) - 1
+
+	idx := arryIndex(keys[last])
+	if idx < 0 {
+		return "/" + newPath
+	}
+
+	parent, err := holder.get(strings.Join(keys[:last], "/"))
+	if err == nil {
+		if arryNode, ok := parent.(ArryNode); ok && len(arryNode) > idx {
+			idx = len(arryNode)
+		}
+	}
+
+	keys[last] = strconv.Itoa(idx)
+	return "/" + strings.Join(keys, "/")
+}